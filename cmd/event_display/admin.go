@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// HTTP path of the status page served by the metrics server.
+const statusPath = "/"
+
+// Number of the last event types shown on the status page.
+const statusEventTypes = 5
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>event_display</title></head>
+<body>
+<h1>event_display</h1>
+<dl>
+<dt>Uptime</dt><dd>{{.Uptime}}</dd>
+<dt>Events received</dt><dd>{{.Received}}</dd>
+<dt>Events per second</dt><dd>{{printf "%.2f" .Rate}}</dd>
+</dl>
+{{with .Types}}<h2>Last event types</h2>
+<ul>
+{{range .}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+// statusMiddleware exposes a status page with the uptime since start, the
+// number and rate of received events, and the types of the last events of
+// recent, if not nil.
+func statusMiddleware(start time.Time, received *atomic.Uint64, recent *eventBuffer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != statusPath {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		uptime := time.Since(start)
+		data := struct {
+			Uptime   time.Duration
+			Received uint64
+			Rate     float64
+			Types    []string
+		}{
+			Uptime:   uptime.Round(time.Second),
+			Received: received.Load(),
+		}
+		if seconds := uptime.Seconds(); seconds > 0 {
+			data.Rate = float64(data.Received) / seconds
+		}
+		if recent != nil {
+			events := recent.Events()
+			for i := len(events) - 1; i >= 0 && len(data.Types) < statusEventTypes; i-- {
+				data.Types = append(data.Types, events[i].Type())
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusTemplate.Execute(w, data); err != nil {
+			zap.L().Error("Failed to render status page", zap.Error(err))
+		}
+	})
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/atomic"
+)
+
+func TestRun_StatusPage(t *testing.T) {
+	captureLog(t)
+	cfg := testConfig(t)
+	cfg.AdminEnabled = true
+	startRun(t, cfg)
+
+	for i := 0; i < 3; i++ {
+		if res := sendEvent(t, newTestEvent(t)); !cloudevents.IsACK(res) {
+			t.Fatal("Failed to send event:", res)
+		}
+	}
+
+	resp, err := http.Get("http://localhost:9090" + statusPath)
+	if err != nil {
+		t.Fatal("Error getting status page:", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("Error reading status page:", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("Unexpected response to the status page, status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{"<dt>Events received</dt><dd>3</dd>", "<li>dev.knative.eventing.samples.heartbeat</li>"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected the status page to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestNewMetricsHandler_Status(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		rec := httptest.NewRecorder()
+		opts := metricsOptions{adminEnabled: enabled, start: time.Now(), received: atomic.NewUint64(0)}
+		newMetricsHandler(opts).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, statusPath, nil))
+
+		want := http.StatusNotFound
+		if enabled {
+			want = http.StatusOK
+		}
+		if rec.Code != want {
+			t.Errorf("With admin enabled: %t, expected status code %d, got %d", enabled, want, rec.Code)
+		}
+	}
+}
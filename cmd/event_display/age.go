@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+// ageLimit rejects events based on their time attribute.
+type ageLimit struct {
+	// Maximum age of events.
+	maxAge time.Duration
+	// Tolerated difference between the clock of event producers and ours.
+	skew time.Duration
+	// Whether events without a time attribute are rejected.
+	requireTime bool
+}
+
+// Check returns an error if the given event is older than the limit at now.
+func (l ageLimit) Check(event cloudevents.Event, now time.Time) error {
+	t := event.Time()
+	if t.IsZero() {
+		if l.requireTime {
+			return fmt.Errorf("event has no time attribute")
+		}
+		return nil
+	}
+	if age := now.Sub(t); age > l.maxAge+l.skew {
+		return fmt.Errorf("event is %s old, older than %s", age.Round(time.Millisecond), l.maxAge)
+	}
+	return nil
+}
+
+// rejectStaleEvents returns an eventHandler which rejects with a 400 status
+// the events exceeding the given age limit, and passes the others to next.
+func rejectStaleEvents(l ageLimit, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if err := l.Check(event, time.Now()); err != nil {
+			if !event.Time().IsZero() {
+				eventsStale.WithLabelValues().Inc()
+			}
+			return nil, cehttp.NewResult(http.StatusBadRequest, "%v", err)
+		}
+		return next(ctx, event)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+func TestRejectStaleEvents(t *testing.T) {
+	testCases := map[string]struct {
+		age         time.Duration
+		noTime      bool
+		requireTime bool
+		wantPassed  bool
+		wantStale   bool
+	}{
+		"fresh event": {
+			age:        time.Minute,
+			wantPassed: true,
+		},
+		"stale event within clock skew": {
+			age:        10*time.Minute + 20*time.Second,
+			wantPassed: true,
+		},
+		"stale event": {
+			age:        time.Hour,
+			wantPassed: false,
+			wantStale:  true,
+		},
+		"event without time": {
+			noTime:     true,
+			wantPassed: true,
+		},
+		"event without time when required": {
+			noTime:      true,
+			requireTime: true,
+			wantPassed:  false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			event := newTestEvent(t)
+			if tc.noTime {
+				event.SetTime(time.Time{})
+			} else {
+				event.SetTime(time.Now().Add(-tc.age))
+			}
+
+			staleBefore := counterValue(t, "stale_events_total", nil)
+			var passed bool
+			limit := ageLimit{maxAge: 10 * time.Minute, skew: 30 * time.Second, requireTime: tc.requireTime}
+			handler := rejectStaleEvents(limit, func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+				passed = true
+				return nil, nil
+			})
+			_, res := handler(context.Background(), event)
+
+			if passed != tc.wantPassed {
+				t.Errorf("Expected event to be passed: %t, got: %t", tc.wantPassed, passed)
+			}
+			var httpResult *cehttp.Result
+			if rejected := cloudevents.ResultAs(res, &httpResult) && httpResult.StatusCode == http.StatusBadRequest; rejected == tc.wantPassed {
+				t.Errorf("Expected event to be rejected with a 400: %t, got: %v", !tc.wantPassed, res)
+			}
+			if stale := counterValue(t, "stale_events_total", nil) > staleBefore; stale != tc.wantStale {
+				t.Errorf("Expected event to be counted as stale: %t, got: %t", tc.wantStale, stale)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// eventArchive appends events to a file, one JSON object per line. It is safe
+// for concurrent use.
+type eventArchive struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+// openEventArchive opens the archive file at path for appending, creating it
+// if necessary.
+func openEventArchive(path string) (*eventArchive, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &eventArchive{
+		file: f,
+		w:    bufio.NewWriter(f),
+	}, nil
+}
+
+// Append writes the given event to the archive. Every event is flushed to the
+// file as soon as it is written, so the archive can be rotated at any time.
+func (a *eventArchive) Append(event cloudevents.Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.w.Write(b); err != nil {
+		return err
+	}
+	if err := a.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return a.w.Flush()
+}
+
+// Close flushes any buffered event and closes the archive file.
+func (a *eventArchive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	flushErr := a.w.Flush()
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// archiveEvents returns an eventHandler which appends each event to the given
+// archive before passing it to next. Archiving failures don't fail the receive.
+func archiveEvents(archive *eventArchive, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if err := archive.Append(event); err != nil {
+			zap.L().Error("Failed to archive event", zap.String("id", event.ID()), zap.Error(err))
+		}
+		return next(ctx, event)
+	}
+}
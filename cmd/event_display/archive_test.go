@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+func TestArchiveEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	// Pre-existing content is preserved.
+	if err := os.WriteFile(path, []byte(`{"specversion":"1.0","id":"0","source":"/","type":"t"}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := openEventArchive(path)
+	if err != nil {
+		t.Fatal("Error opening archive:", err)
+	}
+
+	captureLog(t)
+	handler := archiveEvents(archive, display(zap.L(), compactRenderer{}))
+
+	event := newTestEvent(t)
+	const numEvents = 10
+	var wg sync.WaitGroup
+	for i := 0; i < numEvents; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler(context.Background(), event)
+		}()
+	}
+	wg.Wait()
+
+	if err := archive.Close(); err != nil {
+		t.Fatal("Error closing archive:", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines int
+	for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+		got := cloudevents.NewEvent()
+		if err := json.Unmarshal(scanner.Bytes(), &got); err != nil {
+			t.Fatalf("Line %d is not a valid JSON CloudEvent: %v\n%s", lines+1, err, scanner.Text())
+		}
+		if lines == 0 {
+			continue
+		}
+		if diff := cmp.Diff(event.String(), got.String()); diff != "" {
+			t.Errorf("Unexpected event on line %d (-want, +got): %s", lines+1, diff)
+		}
+	}
+	if want := numEvents + 1; lines != want {
+		t.Errorf("Expected %d lines in the archive, got %d", want, lines)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// batchMiddleware is a cehttp.Middleware which splits requests in batched
+// content mode into one structured request per event, served in order by the
+// next handler. The batch is acknowledged once all of its events are, and
+// rejected with the status of the first rejected event otherwise. Replies to
+// batched events are discarded. Malformed batches are rejected with a 400.
+func batchMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mediaType != cloudevents.ApplicationCloudEventsBatchJSON {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		var events []cloudevents.Event
+		if err == nil {
+			err = json.Unmarshal(body, &events)
+		}
+		if err != nil {
+			zap.L().Error("Failed to read batch of events", zap.Error(err))
+			http.Error(w, "malformed batch: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		status := http.StatusAccepted
+		for _, event := range events {
+			b, err := json.Marshal(event)
+			if err != nil {
+				zap.L().Error("Failed to marshal batched event", zap.String("id", event.ID()), zap.Error(err))
+				status = http.StatusBadRequest
+				break
+			}
+			r := req.Clone(req.Context())
+			r.Body = io.NopCloser(bytes.NewReader(b))
+			r.ContentLength = int64(len(b))
+			r.Header.Set("Content-Length", strconv.Itoa(len(b)))
+			r.Header.Set("Content-Type", cloudevents.ApplicationCloudEventsJSON)
+
+			rec := &batchResponseWriter{header: make(http.Header)}
+			next.ServeHTTP(rec, r)
+			if rec.Status() >= http.StatusMultipleChoices {
+				status = rec.Status()
+				break
+			}
+		}
+		w.WriteHeader(status)
+	})
+}
+
+// batchResponseWriter is a http.ResponseWriter which discards the response to
+// a batched event, except for its status code.
+type batchResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Status returns the status code of the response, 200 if none was written.
+func (w *batchResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestRun_Batch(t *testing.T) {
+	out := captureLog(t)
+	cfg := testConfig(t)
+	cfg.OutputFormat = "compact"
+	stop := startRun(t, cfg)
+
+	events := make([]cloudevents.Event, 3)
+	for i := range events {
+		events[i] = newTestEvent(t)
+		events[i].SetID("batched-" + strconv.Itoa(i))
+	}
+	if resp := postBatch(t, events); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected the batch to be accepted, got status code %d", resp.StatusCode)
+	}
+	stop()
+
+	var displayed int
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, `"type": dev.knative.eventing.samples.heartbeat`) {
+			displayed++
+		}
+	}
+	if displayed != len(events) {
+		t.Errorf("Expected %d events to be displayed, got %d:\n%s", len(events), displayed, out)
+	}
+	for _, event := range events {
+		if !strings.Contains(out.String(), event.ID()) {
+			t.Errorf("Expected event %s to be displayed, got:\n%s", event.ID(), out)
+		}
+	}
+}
+
+func TestRun_BatchRejected(t *testing.T) {
+	captureLog(t)
+	cfg := testConfig(t)
+	cfg.AllowedContentTypes = []string{"text/plain"}
+	startRun(t, cfg)
+
+	accepted := newTestEvent(t)
+	if err := accepted.SetData("text/plain", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if resp := postBatch(t, []cloudevents.Event{accepted, newTestEvent(t)}); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected the batch to be rejected with the status of the rejected event, got status code %d", resp.StatusCode)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ceClientURL, strings.NewReader(`{"not":"an array"}`))
+	if err != nil {
+		t.Fatal("Error creating request:", err)
+	}
+	req.Header.Set("Content-Type", cloudevents.ApplicationCloudEventsBatchJSON)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error sending request:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a malformed batch to be rejected with a 400, got status code %d", resp.StatusCode)
+	}
+}
+
+// postBatch posts the given events to the receiver in batched content mode.
+func postBatch(t *testing.T, events []cloudevents.Event) *http.Response {
+	t.Helper()
+
+	body, err := json.Marshal(events)
+	if err != nil {
+		t.Fatal("Error marshaling batch:", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, ceClientURL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal("Error creating request:", err)
+	}
+	req.Header.Set("Content-Type", cloudevents.ApplicationCloudEventsBatchJSON)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error sending request:", err)
+	}
+	resp.Body.Close()
+	return resp
+}
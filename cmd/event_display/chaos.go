@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.uber.org/zap"
+)
+
+// failureInjector randomly decides to fail a fraction of events, for chaos
+// testing. It is safe for concurrent use.
+type failureInjector struct {
+	rate float64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// newFailureInjector returns a failureInjector failing the given fraction of
+// events, between 0 and 1, drawn from a source seeded with seed.
+func newFailureInjector(rate float64, seed int64) *failureInjector {
+	return &failureInjector{
+		rate: rate,
+		rand: rand.New(rand.NewSource(seed)), //nolint:gosec // Not used for security.
+	}
+}
+
+// Fail returns whether the next event must fail.
+func (f *failureInjector) Fail() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Float64() < f.rate
+}
+
+// injectFailures returns an eventHandler which rejects the events chosen by
+// the given failureInjector with a 500, and passes the other events to next.
+func injectFailures(f *failureInjector, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if f.Fail() {
+			injectedFailures.WithLabelValues().Inc()
+			zap.L().Info("Injected failure", zap.String("id", event.ID()))
+			return nil, cehttp.NewResult(http.StatusInternalServerError, "injected failure")
+		}
+		return next(ctx, event)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.uber.org/zap"
+)
+
+func TestInjectFailures(t *testing.T) {
+	const events = 100
+	for _, rate := range []float64{0, 1} {
+		captureLog(t)
+		failuresBefore := counterValue(t, "injected_failures_total", nil)
+
+		handler := injectFailures(newFailureInjector(rate, 1), display(zap.L(), compactRenderer{}))
+		var failed int
+		for i := 0; i < events; i++ {
+			_, res := handler(context.Background(), newTestEvent(t))
+			var httpResult *cehttp.Result
+			if cloudevents.ResultAs(res, &httpResult) && httpResult.StatusCode == http.StatusInternalServerError {
+				failed++
+			} else if !cloudevents.IsACK(res) {
+				t.Fatalf("With fail rate %v, expected either a 500 or an ACK, got: %v", rate, res)
+			}
+		}
+
+		want := int(rate * events)
+		if failed != want {
+			t.Errorf("With fail rate %v, expected %d events to fail, got %d", rate, want, failed)
+		}
+		if got := counterValue(t, "injected_failures_total", nil) - failuresBefore; got != float64(want) {
+			t.Errorf("With fail rate %v, expected %d injected failures to be counted, got %v", rate, want, got)
+		}
+	}
+}
+
+func TestFailureInjector_Seed(t *testing.T) {
+	first, second := newFailureInjector(0.5, 42), newFailureInjector(0.5, 42)
+	for i := 0; i < 100; i++ {
+		if first.Fail() != second.Fail() {
+			t.Fatal("Expected injectors with the same seed to fail the same events")
+		}
+	}
+}
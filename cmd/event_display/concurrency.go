@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// concurrencyLimiter tracks the number of requests being handled, and
+// optionally bounds it. It is safe for concurrent use.
+type concurrencyLimiter struct {
+	// Semaphore of the requests being handled, nil when unlimited.
+	slots    chan struct{}
+	inFlight atomic.Int64
+}
+
+// newConcurrencyLimiter returns a concurrencyLimiter allowing at most max
+// requests to be handled at once. Requests aren't limited when max isn't
+// positive.
+func newConcurrencyLimiter(max int) *concurrencyLimiter {
+	l := &concurrencyLimiter{}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
+	}
+	return l
+}
+
+// InFlight returns the number of requests being handled.
+func (l *concurrencyLimiter) InFlight() int {
+	return int(l.inFlight.Load())
+}
+
+// concurrencyMiddleware returns a cehttp.Middleware which rejects with a 503
+// the requests received while the given limiter is saturated, so that senders
+// back off.
+func concurrencyMiddleware(l *concurrencyLimiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if l.slots != nil {
+				select {
+				case l.slots <- struct{}{}:
+					defer func() { <-l.slots }()
+				default:
+					zap.L().Debug("Rejected request, too many requests in flight", zap.Int("max", cap(l.slots)))
+					http.Error(w, "too many requests in flight", http.StatusServiceUnavailable)
+					return
+				}
+			}
+
+			l.inFlight.Inc()
+			defer l.inFlight.Dec()
+			next.ServeHTTP(w, req)
+		})
+	}
+}
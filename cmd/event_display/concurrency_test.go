@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestConcurrencyMiddleware(t *testing.T) {
+	const max = 2
+
+	entered := make(chan struct{}, max+1)
+	release := make(chan struct{})
+	handler := concurrencyMiddleware(newConcurrencyLimiter(max))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+
+	// Hold all the slots.
+	var wg sync.WaitGroup
+	for i := 0; i < max; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+		}()
+		<-entered
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d when saturated, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	close(release)
+	wg.Wait()
+
+	// Slots are freed once requests are handled.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d once slots are freed, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestConcurrencyLimiter_Readiness(t *testing.T) {
+	const unhealthyInFlight = 2
+
+	limiter := newConcurrencyLimiter(0)
+	entered := make(chan struct{}, unhealthyInFlight)
+	release := make(chan struct{})
+	ready := func() bool { return limiter.InFlight() < unhealthyInFlight }
+	handler := readyzMiddleware(ready)(concurrencyMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})))
+
+	probe := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, readyzPath, nil))
+		return rec.Code
+	}
+
+	if got := probe(); got != http.StatusNoContent {
+		t.Error("Unexpected readiness status code before being saturated:", got)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < unhealthyInFlight; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+		}()
+		<-entered
+	}
+
+	if got := probe(); got != http.StatusServiceUnavailable {
+		t.Error("Unexpected readiness status code while saturated:", got)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if got := probe(); got != http.StatusNoContent {
+		t.Error("Unexpected readiness status code after recovering:", got)
+	}
+}
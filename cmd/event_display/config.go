@@ -0,0 +1,434 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of event_display. Every option can be set with
+// a command-line flag, or with an environment variable named after the flag,
+// e.g. LOG_LEVEL for --log-level. Flags take precedence over environment
+// variables.
+type Config struct {
+	// Whether the configuration is checked and printed, without receiving
+	// events.
+	DryRun bool
+
+	// Duration after which event_display shuts down, unlimited if 0.
+	MaxRuntime time.Duration
+	// Number of displayed events after which event_display shuts down,
+	// unlimited if 0.
+	MaxEvents uint64
+
+	// Output.
+	LogFilePath       string
+	LogStream         string
+	OutputStream      string
+	SyslogAddr        string
+	SyslogEvents      bool
+	LogLevel          string
+	Quiet             bool
+	OutputFormat      string
+	OutputIndent      string
+	DisplayExtensions string
+	DisplayTimezone   string
+	DisplayData       string
+	DisplaySampleRate float64
+	AlwaysDisplayType []string
+	DiscoveryMode     bool
+	DiffMode          bool
+	NackDisplayErrors bool
+	ExtractJSONPath   string
+	HashBody          bool
+	Outputs           string
+
+	// Tracing.
+	ConfigTracing     string
+	ConfigTracingPath string
+	TracingBackend    string
+	OTLPEndpoint      string
+
+	// Replay.
+	ReplayFile string
+	ReplayRate float64
+
+	// Receiver.
+	Protocol              string
+	Port                  int
+	ListenSocket          string
+	BindAddress           string
+	MQTTBroker            string
+	MQTTTopic             string
+	MQTTClientID          string
+	ReceiverPath          string
+	HealthPath            string
+	RequestLoggingEnabled bool
+	AccessLog             bool
+	MaxLogBodyBytes       int64
+	RedactHeaders         []string
+	ResponseHeaders       string
+	StrictValidation      bool
+	MaxConcurrency        int
+	UnhealthyInflight     int
+	WebhookSecret         string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSClientCAFile       string
+	DataSchemaFile        string
+
+	// Metrics server.
+	MetricsPort          int
+	SinglePort           bool
+	PprofEnabled         bool
+	AdminEnabled         bool
+	TailEnabled          bool
+	EventBufferSize      int
+	LargeEventBytes      int
+	MaxDecompressedBytes int64
+
+	// Event handling.
+	SummaryInterval             time.Duration
+	ProcessingDelay             time.Duration
+	EventArchivePath            string
+	RouteByType                 bool
+	RouteDir                    string
+	MaxRoutedFiles              int
+	Sink                        string
+	Sinks                       []string
+	Route                       string
+	ForwardRequired             bool
+	ForwardInsecureSkipVerify   bool
+	ForwardMaxRetries           int
+	ForwardBaseDelay            time.Duration
+	ForwardTimeout              time.Duration
+	ForwardExtension            string
+	SinkProbeEnabled            bool
+	SinkProbeInterval           time.Duration
+	SinkProbeTimeout            time.Duration
+	ReplyEnabled                bool
+	ReplyType                   string
+	Transform                   string
+	StampReceivedTime           bool
+	FilterExtension             string
+	FilterTypePrefix            []string
+	AllowedContentTypes         []string
+	FetchSchema                 bool
+	SequenceCheckEnabled        bool
+	MaxSequenceSources          int
+	DedupWindow                 time.Duration
+	MaxEventAge                 time.Duration
+	ClockSkewTolerance          time.Duration
+	RequireEventTime            bool
+	MaxEventsPerSecondPerSource float64
+	MaxRateLimitedSources       int
+	FailRate                    float64
+	FailSeed                    int64
+
+	// Writer to which events are displayed, the output of the standard logger
+	// if nil. It isn't set by flags but by main, from OutputStream.
+	EventOutput io.Writer `json:"-"`
+}
+
+// Environment variables which aren't named after their flag.
+var flagEnvNames = map[string]string{
+	"sink":                "K_SINK",
+	"sinks":               "K_SINKS",
+	"config-tracing":      "K_CONFIG_TRACING",
+	"config-tracing-path": "K_CONFIG_TRACING_PATH",
+}
+
+// envName returns the name of the environment variable of the given flag.
+func envName(flagName string) string {
+	if name, ok := flagEnvNames[flagName]; ok {
+		return name
+	}
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig returns the configuration set by the command-line arguments and
+// the environment of the process.
+func loadConfig() (Config, error) {
+	return parseConfig(os.Args[1:], os.LookupEnv)
+}
+
+// parseConfig returns the configuration set by the given command-line
+// arguments and by the environment variables returned by lookupEnv, falling
+// back to defaults.
+func parseConfig(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	var c Config
+	c.RedactHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+	fs := flag.NewFlagSet("event_display", flag.ContinueOnError)
+
+	fs.BoolVar(&c.DryRun, "dry-run", false, "check and print the configuration, then exit")
+	fs.DurationVar(&c.MaxRuntime, "max-runtime", 0, "duration after which event_display shuts down, 0 to run until terminated")
+	fs.Uint64Var(&c.MaxEvents, "max-events", 0, "number of displayed events after which event_display shuts down, 0 to run until terminated")
+
+	fs.StringVar(&c.LogFilePath, "log-file-path", "/var/log/app.log", `file to which logs and events are also written, "none" to disable`)
+	fs.StringVar(&c.LogStream, "log-stream", "stdout", "stream of operational logs, stdout or stderr")
+	fs.StringVar(&c.OutputStream, "output-stream", "stdout", "stream of displayed events, stdout or stderr")
+	fs.StringVar(&c.SyslogAddr, "syslog-addr", "", "[udp://|tcp://]host:port of a syslog server to which logs are also sent")
+	fs.BoolVar(&c.SyslogEvents, "syslog-events", false, "also send displayed events to the syslog server")
+	fs.StringVar(&c.LogLevel, "log-level", "info", "minimum level of logs, debug, info, warn or error")
+	fs.BoolVar(&c.Quiet, "quiet", false, "log nothing but displayed events and fatal errors")
+	fs.StringVar(&c.OutputFormat, "output-format", "pretty", "format of displayed events, pretty, compact, json, yaml, ndjson or csv")
+	fs.StringVar(&c.OutputIndent, "output-indent", "", "indent of events displayed as json and of logged requests, a number of spaces, tab or compact")
+	fs.StringVar(&c.DisplayExtensions, "display-extensions", "all", `comma-separated extensions displayed, "all" or "none"`)
+	fs.StringVar(&c.DisplayTimezone, "display-timezone", "", "IANA time zone in which event times are displayed")
+	fs.StringVar(&c.Outputs, "outputs", "", "comma-separated format:target outputs of events, e.g. pretty:stdout,jsonl:/var/log/events.jsonl, overriding the output format and stream")
+	fs.StringVar(&c.DisplayData, "display-data", "decoded", "how JSON data is displayed: decoded with sorted keys, or raw")
+	fs.Float64Var(&c.DisplaySampleRate, "display-sample-rate", 1, "fraction of received events displayed, sampled by id")
+	fs.Var((*listValue)(&c.AlwaysDisplayType), "always-display-type", "comma-separated glob patterns of types of events displayed regardless of the sample rate, such as *.error.*")
+	fs.BoolVar(&c.DiscoveryMode, "discovery-mode", false, "display only the first event of each type, source and data content type")
+	fs.BoolVar(&c.DiffMode, "diff-mode", false, "display events as a diff of their data against the previous event of their type")
+	fs.BoolVar(&c.NackDisplayErrors, "nack-display-errors", false, "reject events failing to be rendered with a 500, so that senders retry them")
+	fs.StringVar(&c.ExtractJSONPath, "extract-jsonpath", "", "JSONPath of a value of JSON data logged with each event, such as $.order.id")
+	fs.BoolVar(&c.HashBody, "hash-body", false, "log the SHA-256 of the data of each event, checked against its datasha256 extension when forwarding")
+
+	fs.StringVar(&c.ConfigTracing, "config-tracing", "", "tracing configuration, as JSON")
+	fs.StringVar(&c.ConfigTracingPath, "config-tracing-path", "", "file of the tracing configuration, as JSON, reloaded on change and taking precedence over config-tracing")
+	fs.StringVar(&c.TracingBackend, "tracing-backend", "opencensus", "tracing backend, opencensus or otel to export spans to an OTLP collector")
+	fs.StringVar(&c.OTLPEndpoint, "otel-exporter-otlp-endpoint", "http://localhost:4318", "base URL of the OTLP/HTTP collector of the otel tracing backend")
+
+	fs.StringVar(&c.ReplayFile, "replay-file", "", "archive of events to send to the sink instead of receiving events")
+	fs.Float64Var(&c.ReplayRate, "replay-rate", 1, "maximum number of events replayed per second")
+
+	fs.StringVar(&c.Protocol, "protocol", "http", "protocol over which events are received, http, grpc or mqtt")
+	fs.IntVar(&c.Port, "port", 8080, "port on which events are received")
+	fs.StringVar(&c.ListenSocket, "listen-socket", "", "path of a Unix domain socket on which events are received instead of the port")
+	fs.StringVar(&c.BindAddress, "bind-address", "", "host:port address on which events are received instead of the port, such as [::]:8080")
+	fs.StringVar(&c.MQTTBroker, "mqtt-broker", "", "[tcp://]host:port of the MQTT 3.1.1 broker from which events are received with the mqtt protocol, without TLS nor authentication")
+	fs.StringVar(&c.MQTTTopic, "mqtt-topic", "", "MQTT topic filter to which events are published")
+	fs.StringVar(&c.MQTTClientID, "mqtt-client-id", "event_display", "client identifier of the MQTT connection")
+	fs.StringVar(&c.ReceiverPath, "receiver-path", "/", "HTTP path on which events are received")
+	fs.StringVar(&c.HealthPath, "health-path", healthzPath, "HTTP path of the health endpoint")
+	fs.BoolVar(&c.RequestLoggingEnabled, "request-logging-enabled", false, "log incoming requests, which might contain sensitive information")
+	fs.BoolVar(&c.AccessLog, "access-log", false, "log the method, path, status and duration of handled requests")
+	fs.Int64Var(&c.MaxLogBodyBytes, "max-log-body-bytes", 65536, "maximum number of body bytes logged per request, unlimited if not positive")
+	fs.Var((*listValue)(&c.RedactHeaders), "redact-headers", "comma-separated headers redacted from request logs, none if empty")
+	fs.StringVar(&c.ResponseHeaders, "response-headers", "", "comma-separated name:value pairs of headers set on every response")
+	fs.BoolVar(&c.StrictValidation, "strict-validation", false, "reject invalid events with a 400 instead of acknowledging them")
+	fs.IntVar(&c.MaxConcurrency, "max-concurrency", 0, "maximum number of requests handled at once, unlimited if not positive")
+	fs.IntVar(&c.UnhealthyInflight, "unhealthy-inflight", 0, "number of requests in flight from which the readiness probe fails, disabled if not positive")
+	fs.StringVar(&c.WebhookSecret, "webhook-secret", "", "secret of the HMAC-SHA256 signature required in the X-Signature header")
+	fs.StringVar(&c.TLSCertFile, "tls-cert-file", "", "certificate file to serve HTTPS")
+	fs.StringVar(&c.TLSKeyFile, "tls-key-file", "", "private key file to serve HTTPS")
+	fs.StringVar(&c.TLSClientCAFile, "tls-client-ca-file", "", "CA file to require and verify client certificates")
+	fs.StringVar(&c.DataSchemaFile, "data-schema-file", "", "path of a JSON Schema against which JSON event data is validated")
+
+	fs.IntVar(&c.MetricsPort, "metrics-port", 9090, "port of the metrics server")
+	fs.BoolVar(&c.SinglePort, "single-port", false, "serve the endpoints of the metrics server on the receiver's port instead of the metrics port")
+	fs.BoolVar(&c.PprofEnabled, "pprof-enabled", false, "serve profiling endpoints on the metrics server")
+	fs.BoolVar(&c.AdminEnabled, "admin-enabled", false, "expose the administration endpoints on the metrics server, e.g. to reset metrics")
+	fs.BoolVar(&c.TailEnabled, "tail-enabled", false, "stream received events to WebSocket clients of the metrics server")
+	fs.IntVar(&c.EventBufferSize, "event-buffer-size", 100, "number of last received events served on the metrics server, 0 to disable")
+	fs.IntVar(&c.LargeEventBytes, "large-event-bytes", 1<<20, "size of event data above which events are counted as large")
+	fs.Int64Var(&c.MaxDecompressedBytes, "max-decompressed-bytes", 32<<20, "maximum size of gzip-encoded request bodies once decompressed")
+
+	fs.DurationVar(&c.SummaryInterval, "summary-interval", 0, "interval of summaries logged instead of displaying events, 0 to display events")
+	fs.DurationVar(&c.ProcessingDelay, "processing-delay", 0, "delay before displaying each event, to simulate a slow consumer")
+	fs.StringVar(&c.EventArchivePath, "event-archive-path", "", "file to which received events are appended as JSON lines")
+	fs.BoolVar(&c.RouteByType, "route-by-type", false, "append received events as JSON lines to one events-<type>.jsonl file per type")
+	fs.StringVar(&c.RouteDir, "route-dir", ".", "directory of the files of events routed by type")
+	fs.IntVar(&c.MaxRoutedFiles, "max-routed-files", 100, "maximum number of files of events routed by type kept open")
+	fs.StringVar(&c.Sink, "sink", "", "URL to which events are forwarded")
+	fs.Var((*listValue)(&c.Sinks), "sinks", "comma-separated URLs to which events are forwarded, in addition to the sink")
+	fs.StringVar(&c.Route, "route", "", "comma-separated attribute=regexp:URL routes of events forwarded to a specific sink instead of the other sinks, e.g. type=order\\..*:http://orders")
+	fs.BoolVar(&c.ForwardRequired, "forward-required", false, "reject events which fail to be forwarded")
+	fs.BoolVar(&c.ForwardInsecureSkipVerify, "forward-insecure-skip-verify", false, "don't verify the certificates of sinks, for testing only")
+	fs.IntVar(&c.ForwardMaxRetries, "forward-max-retries", 0, "maximum number of retries of events failing to be forwarded")
+	fs.DurationVar(&c.ForwardBaseDelay, "forward-base-delay", 50*time.Millisecond, "delay before retrying to forward an event, doubled at each retry")
+	fs.DurationVar(&c.ForwardTimeout, "forward-timeout", 30*time.Second, "timeout of forwarding an event to a sink, retries included, unlimited if 0")
+	fs.StringVar(&c.ForwardExtension, "forward-extension", "", "name=value extension set on forwarded events only, e.g. forwardedby=event_display")
+	fs.BoolVar(&c.SinkProbeEnabled, "sink-probe-enabled", false, "fail the readiness probe while no sink responds to HEAD requests")
+	fs.DurationVar(&c.SinkProbeInterval, "sink-probe-interval", 10*time.Second, "interval of the probes of sinks")
+	fs.DurationVar(&c.SinkProbeTimeout, "sink-probe-timeout", 2*time.Second, "timeout of each probe of a sink")
+	fs.BoolVar(&c.ReplyEnabled, "reply-enabled", false, "reply to each event with a copy of it")
+	fs.StringVar(&c.ReplyType, "reply-type", "", "type of reply events, the type of the received event if empty")
+	fs.StringVar(&c.Transform, "transform", "", `JSON changes applied to events, e.g. {"set":{"environment":"prod"},"rename":{"old":"new"}}`)
+	fs.BoolVar(&c.StampReceivedTime, "stamp-received-time", false, "set the receivedat extension of events to their time of reception")
+	fs.StringVar(&c.FilterExtension, "filter-extension", "", "comma-separated key=value extensions required to display events")
+	fs.Var((*listValue)(&c.FilterTypePrefix), "filter-type-prefix", "comma-separated prefixes of the types of displayed events")
+	fs.Var((*listValue)(&c.AllowedContentTypes), "allowed-content-types", "comma-separated data content types of accepted events, all if empty")
+	fs.BoolVar(&c.FetchSchema, "fetch-schema", false, "fetch and cache the dataschema of events, logging failures")
+	fs.BoolVar(&c.SequenceCheckEnabled, "sequence-check-enabled", false, "warn about events whose sequence extension is out of order or follows a gap")
+	fs.IntVar(&c.MaxSequenceSources, "max-sequence-sources", 1000, "maximum number of sources tracked by the sequence check")
+	fs.DurationVar(&c.DedupWindow, "dedup-window", 0, "window in which redelivered events aren't displayed, 0 to disable")
+	fs.DurationVar(&c.MaxEventAge, "max-event-age", 0, "maximum age of accepted events, 0 to accept events of any age")
+	fs.DurationVar(&c.ClockSkewTolerance, "clock-skew-tolerance", 0, "tolerated skew between the clocks of event producers and the receiver's")
+	fs.BoolVar(&c.RequireEventTime, "require-event-time", false, "reject events without a time attribute when a maximum event age is set")
+	fs.Float64Var(&c.MaxEventsPerSecondPerSource, "max-events-per-second-per-source", 0, "maximum rate of events accepted from each source, unlimited if not positive")
+	fs.IntVar(&c.MaxRateLimitedSources, "max-rate-limited-sources", 1000, "maximum number of sources tracked by the rate limiter")
+	fs.Float64Var(&c.FailRate, "fail-rate", 0, "fraction of events rejected with a 500, for chaos testing")
+	fs.Int64Var(&c.FailSeed, "fail-seed", 0, "seed of the random choice of rejected events, the current time if 0")
+
+	// Environment variables override defaults, so they are set before flags
+	// are parsed.
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		env := envName(f.Name)
+		f.Usage += fmt.Sprintf(" (env %s)", env)
+
+		value, ok := lookupEnv(env)
+		if !ok {
+			return
+		}
+		// Empty values only make sense for strings, and for lists, which
+		// they clear, e.g. to turn off the default redacted headers.
+		switch f.Value.(flag.Getter).Get().(type) {
+		case string, []string:
+		default:
+			if value == "" {
+				return
+			}
+		}
+		if err := fs.Set(f.Name, value); err != nil && envErr == nil {
+			envErr = fmt.Errorf("invalid value %q for %s: %w", value, env, err)
+		}
+	})
+	if envErr != nil {
+		return Config{}, envErr
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return c, c.validate()
+}
+
+// validate returns an error if the configuration has invalid values.
+func (c Config) validate() error {
+	if c.OutputIndent != "" {
+		if _, err := parseIndent(c.OutputIndent); err != nil {
+			return err
+		}
+	}
+	switch {
+	case c.TracingBackend != "opencensus" && c.TracingBackend != "otel":
+		return fmt.Errorf("unknown tracing backend %q", c.TracingBackend)
+	case c.TracingBackend == "otel" && !validOTLPEndpoint(c.OTLPEndpoint):
+		return fmt.Errorf("invalid OTLP endpoint %q, expected an http or https URL", c.OTLPEndpoint)
+	case c.DisplayData != "decoded" && c.DisplayData != "raw":
+		return fmt.Errorf("unknown data display %q, expected decoded or raw", c.DisplayData)
+	case c.DisplaySampleRate <= 0 || c.DisplaySampleRate > 1:
+		return errors.New("display sample rate must be greater than 0 and at most 1")
+	case !validPatterns(c.AlwaysDisplayType):
+		return fmt.Errorf("invalid pattern of always displayed types in %q", strings.Join(c.AlwaysDisplayType, ","))
+	case c.MaxRuntime < 0:
+		return errors.New("max runtime must not be negative")
+	case c.ReplayRate <= 0:
+		return errors.New("replay rate must be positive")
+	case c.LargeEventBytes < 0:
+		return errors.New("large event bytes must not be negative")
+	case c.MaxDecompressedBytes <= 0:
+		return errors.New("max decompressed bytes must be positive")
+	case c.EventBufferSize < 0:
+		return errors.New("event buffer size must not be negative")
+	case c.SummaryInterval < 0:
+		return errors.New("summary interval must not be negative")
+	case c.FailRate < 0 || c.FailRate > 1:
+		return errors.New("fail rate must be between 0 and 1")
+	case c.ProcessingDelay < 0:
+		return errors.New("processing delay must not be negative")
+	case c.DedupWindow < 0:
+		return errors.New("dedup window must not be negative")
+	case c.MaxSequenceSources < 1:
+		return errors.New("max sequence sources must be positive")
+	case c.MaxRateLimitedSources < 1:
+		return errors.New("max rate limited sources must be positive")
+	case c.MaxRoutedFiles < 1:
+		return errors.New("max routed files must be positive")
+	case c.ForwardTimeout < 0:
+		return errors.New("forward timeout must not be negative")
+	case c.ForwardMaxRetries < 0:
+		return errors.New("forward max retries must not be negative")
+	case c.SinkProbeInterval <= 0:
+		return errors.New("sink probe interval must be positive")
+	case c.SinkProbeTimeout <= 0:
+		return errors.New("sink probe timeout must be positive")
+	case c.MaxEventAge < 0:
+		return errors.New("maximum event age must not be negative")
+	case c.ClockSkewTolerance < 0:
+		return errors.New("clock skew tolerance must not be negative")
+	case c.SyslogAddr != "" && !isSyslogAddr(c.SyslogAddr):
+		return fmt.Errorf("invalid syslog address %q, expected [udp://|tcp://]host:port", c.SyslogAddr)
+	case c.BindAddress != "" && c.ListenSocket != "":
+		return errors.New("bind address and listen socket are mutually exclusive")
+	case c.BindAddress != "" && !isHostPort(c.BindAddress):
+		return fmt.Errorf("invalid bind address %q, expected host:port", c.BindAddress)
+	case c.Protocol != "http" && c.Protocol != "grpc" && c.Protocol != "mqtt":
+		return fmt.Errorf("unknown protocol %q, expected http, grpc or mqtt", c.Protocol)
+	case c.Protocol == "mqtt" && (c.MQTTBroker == "" || c.MQTTTopic == ""):
+		return errors.New("the mqtt protocol requires an MQTT broker and topic")
+	case c.Protocol == "mqtt" && !isHostPort(mqttBrokerAddress(c.MQTTBroker)):
+		return fmt.Errorf("invalid MQTT broker %q, expected [tcp://]host:port", c.MQTTBroker)
+	case c.SinglePort && c.Protocol != "http":
+		return fmt.Errorf("single port is unsupported with the %s protocol", c.Protocol)
+	case c.SinglePort && isMetricsServerPath(c.ReceiverPath):
+		return fmt.Errorf("receiver path %q is served by the metrics server on the single port", c.ReceiverPath)
+	}
+	return nil
+}
+
+// isHostPort returns whether s is a host:port address, with an IPv6 host in
+// brackets.
+func isHostPort(s string) bool {
+	_, _, err := net.SplitHostPort(s)
+	return err == nil
+}
+
+// isSyslogAddr returns whether s is the address of a syslog server,
+// [udp://|tcp://]host:port.
+func isSyslogAddr(s string) bool {
+	network, hostPort := syslogNetwork(s)
+	return (network == "udp" || network == "tcp") && isHostPort(hostPort)
+}
+
+// validPatterns returns whether all the given glob patterns are well-formed.
+func validPatterns(patterns []string) bool {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// listValue is a flag.Value of a comma-separated list.
+type listValue []string
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(s string) error {
+	*l = splitList(s)
+	return nil
+}
+
+func (l *listValue) Get() interface{} {
+	return []string(*l)
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseConfig_Precedence(t *testing.T) {
+	env := mapEnv(map[string]string{
+		"PORT":               "8081",
+		"OUTPUT_FORMAT":      "json",
+		"K_SINK":             "http://sink.example.com",
+		"FILTER_TYPE_PREFIX": "com.example.",
+	})
+
+	cfg, err := parseConfig([]string{"--port=8082", "--filter-type-prefix", "dev.knative., org.example."}, env)
+	if err != nil {
+		t.Fatal("Error parsing config:", err)
+	}
+
+	// Flags win over environment variables, which win over defaults.
+	if cfg.Port != 8082 {
+		t.Errorf("Expected the port of the flag, got %d", cfg.Port)
+	}
+	if diff := cmp.Diff([]string{"dev.knative.", "org.example."}, cfg.FilterTypePrefix); diff != "" {
+		t.Error("Expected the type prefixes of the flag (-want, +got):", diff)
+	}
+	if cfg.OutputFormat != "json" {
+		t.Errorf("Expected the output format of the environment, got %q", cfg.OutputFormat)
+	}
+	if cfg.Sink != "http://sink.example.com" {
+		t.Errorf("Expected the sink of the environment, got %q", cfg.Sink)
+	}
+	if cfg.ReceiverPath != "/" || cfg.MaxLogBodyBytes != 65536 || cfg.SummaryInterval != 0 {
+		t.Errorf("Expected defaults for unset options, got %+v", cfg)
+	}
+}
+
+func TestParseConfig_Env(t *testing.T) {
+	env := mapEnv(map[string]string{
+		"LOG_FILE_PATH":           "",
+		"SUMMARY_INTERVAL":        "30s",
+		"REQUEST_LOGGING_ENABLED": "true",
+		"STRICT_VALIDATION":       "",
+		"REDACT_HEADERS":          "X-Api-Key",
+	})
+
+	cfg, err := parseConfig(nil, env)
+	if err != nil {
+		t.Fatal("Error parsing config:", err)
+	}
+
+	if cfg.LogFilePath != "" {
+		t.Errorf("Expected an empty log file path to be kept, got %q", cfg.LogFilePath)
+	}
+	if cfg.SummaryInterval != 30*time.Second || !cfg.RequestLoggingEnabled || cfg.StrictValidation {
+		t.Errorf("Unexpected typed options, got %+v", cfg)
+	}
+	if diff := cmp.Diff([]string{"X-Api-Key"}, cfg.RedactHeaders); diff != "" {
+		t.Error("Unexpected redacted headers (-want, +got):", diff)
+	}
+}
+
+func TestParseConfig_EmptyList(t *testing.T) {
+	cfg, err := parseConfig(nil, mapEnv(map[string]string{"REDACT_HEADERS": ""}))
+	if err != nil {
+		t.Fatal("Error parsing config:", err)
+	}
+	if len(cfg.RedactHeaders) != 0 {
+		t.Errorf("Expected no redacted headers, got %q", cfg.RedactHeaders)
+	}
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	testCases := map[string]struct {
+		env  map[string]string
+		args []string
+	}{
+		"invalid environment variable": {
+			env: map[string]string{"PORT": "http"},
+		},
+		"invalid flag": {
+			args: []string{"--max-concurrency=many"},
+		},
+		"unknown flag": {
+			args: []string{"--colour"},
+		},
+		"unknown protocol": {
+			env: map[string]string{"PROTOCOL": "amqp"},
+		},
+		"mqtt protocol without topic": {
+			env: map[string]string{"PROTOCOL": "mqtt", "MQTT_BROKER": "localhost:1883"},
+		},
+		"invalid mqtt broker": {
+			env: map[string]string{"PROTOCOL": "mqtt", "MQTT_BROKER": "localhost", "MQTT_TOPIC": "events"},
+		},
+		"non-positive replay rate": {
+			env: map[string]string{"REPLAY_RATE": "0"},
+		},
+		"non-positive sink probe timeout": {
+			env: map[string]string{"SINK_PROBE_TIMEOUT": "0s"},
+		},
+		"non-positive max decompressed bytes": {
+			env: map[string]string{"MAX_DECOMPRESSED_BYTES": "0"},
+		},
+		"non-positive max sequence sources": {
+			env: map[string]string{"MAX_SEQUENCE_SOURCES": "0"},
+		},
+		"non-positive max rate limited sources": {
+			env: map[string]string{"MAX_RATE_LIMITED_SOURCES": "-1"},
+		},
+		"non-positive max routed files": {
+			env: map[string]string{"MAX_ROUTED_FILES": "0"},
+		},
+		"unknown tracing backend": {
+			env: map[string]string{"TRACING_BACKEND": "zipkin"},
+		},
+		"invalid otlp endpoint": {
+			env: map[string]string{"TRACING_BACKEND": "otel", "OTEL_EXPORTER_OTLP_ENDPOINT": "localhost:4318"},
+		},
+		"negative summary interval": {
+			args: []string{"--summary-interval=-1s"},
+		},
+		"invalid output indent": {
+			env: map[string]string{"OUTPUT_INDENT": "wide"},
+		},
+		"receiver path shadowed on the single port": {
+			env: map[string]string{"SINGLE_PORT": "true", "RECEIVER_PATH": "/metrics"},
+		},
+		"syslog address of an unknown network": {
+			env: map[string]string{"SYSLOG_ADDR": "unix:///dev/log"},
+		},
+		"malformed always displayed type": {
+			env: map[string]string{"ALWAYS_DISPLAY_TYPE": "dev.[error"},
+		},
+		"bind address without port": {
+			env: map[string]string{"BIND_ADDRESS": "::1"},
+		},
+		"bind address and listen socket": {
+			env: map[string]string{"BIND_ADDRESS": "[::]:8080", "LISTEN_SOCKET": "/tmp/event_display.sock"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseConfig(tc.args, mapEnv(tc.env)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// testConfig returns the default configuration, regardless of the environment
+// of the test.
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	cfg, err := parseConfig(nil, mapEnv(nil))
+	if err != nil {
+		t.Fatal("Error parsing config:", err)
+	}
+	return cfg
+}
+
+// mapEnv returns a lookup function of the environment variables in env.
+func mapEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
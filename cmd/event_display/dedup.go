@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// eventKey identifies an event, as per the CloudEvents spec.
+type eventKey struct {
+	source string
+	id     string
+}
+
+// deduplicator detects events already seen within a sliding time window.
+// Events older than the window are evicted periodically, to bound memory
+// usage. It is safe for concurrent use.
+type deduplicator struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[eventKey]time.Time
+}
+
+// newDeduplicator returns a deduplicator detecting events seen within the
+// given window.
+func newDeduplicator(window time.Duration) *deduplicator {
+	return &deduplicator{
+		window: window,
+		seen:   make(map[eventKey]time.Time),
+	}
+}
+
+// Seen records the given event as seen at now, and returns whether it was
+// already seen within the window.
+func (d *deduplicator) Seen(event cloudevents.Event, now time.Time) bool {
+	key := eventKey{source: event.Source(), id: event.ID()}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	last, ok := d.seen[key]
+	d.seen[key] = now
+	return ok && now.Sub(last) < d.window
+}
+
+// Evict forgets the events last seen before the window ending at now.
+func (d *deduplicator) Evict(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, last := range d.seen {
+		if now.Sub(last) >= d.window {
+			delete(d.seen, key)
+		}
+	}
+}
+
+// Run evicts old events at every window until ctx is cancelled.
+func (d *deduplicator) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			d.Evict(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deduplicate returns an eventHandler which acknowledges without handling the
+// events already seen by the given deduplicator, and passes the others to
+// next.
+func deduplicate(d *deduplicator, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if d.Seen(event, time.Now()) {
+			zap.L().Debug("Suppressed duplicate event", zap.String("source", event.Source()), zap.String("id", event.ID()))
+			eventsDuplicate.WithLabelValues().Inc()
+			return nil, nil
+		}
+		return next(ctx, event)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestDeduplicate(t *testing.T) {
+	captureLog(t)
+	duplicatesBefore := counterValue(t, "events_duplicate_total", nil)
+
+	var handled int
+	handler := deduplicate(newDeduplicator(time.Minute), func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		handled++
+		return nil, nil
+	})
+
+	event := newTestEvent(t)
+	for i := 0; i < 2; i++ {
+		if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+			t.Error("Expected event to be acknowledged, got:", res)
+		}
+	}
+
+	if handled != 1 {
+		t.Errorf("Expected the duplicate to be suppressed, got %d events handled", handled)
+	}
+	if got := counterValue(t, "events_duplicate_total", nil) - duplicatesBefore; got != 1 {
+		t.Errorf("Expected 1 duplicate to be counted, got %v", got)
+	}
+}
+
+func TestDeduplicator_Window(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := newDeduplicator(5 * time.Minute)
+	event := newTestEvent(t)
+	other := newTestEvent(t)
+	other.SetSource("/apis/v1/namespaces/default/pingsources/ping")
+
+	if d.Seen(event, start) {
+		t.Error("Expected the first delivery not to be a duplicate")
+	}
+	if !d.Seen(event, start.Add(time.Minute)) {
+		t.Error("Expected a redelivery within the window to be a duplicate")
+	}
+	if d.Seen(other, start.Add(time.Minute)) {
+		t.Error("Expected an event with the same id from another source not to be a duplicate")
+	}
+	if d.Seen(event, start.Add(7*time.Minute)) {
+		t.Error("Expected a redelivery outside the window not to be a duplicate")
+	}
+
+	d.Evict(start.Add(20 * time.Minute))
+	if len(d.seen) != 0 {
+		t.Errorf("Expected all events to be evicted, got %d", len(d.seen))
+	}
+}
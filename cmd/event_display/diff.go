@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// diffRenderer renders the first event of each type with the next renderer,
+// and the following ones as a unified diff of their data against the data of
+// the previous event of the same type.
+type diffRenderer struct {
+	next eventRenderer
+
+	mu sync.Mutex
+	// Data and ID of the last rendered event, by type.
+	previous map[string]renderedData
+}
+
+// renderedData is the data of a rendered event, as compared by diffRenderer.
+type renderedData struct {
+	id   string
+	data string
+}
+
+func newDiffRenderer(next eventRenderer) *diffRenderer {
+	return &diffRenderer{
+		next:     next,
+		previous: make(map[string]renderedData),
+	}
+}
+
+func (r *diffRenderer) Render(event cloudevents.Event) (string, error) {
+	current := renderedData{id: event.ID(), data: diffableData(event)}
+	r.mu.Lock()
+	previous, ok := r.previous[event.Type()]
+	r.previous[event.Type()] = current
+	r.mu.Unlock()
+	if !ok {
+		return r.next.Render(event)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(previous.data),
+		B:        difflib.SplitLines(current.data),
+		FromFile: previous.id,
+		ToFile:   current.id,
+		Context:  3,
+	})
+	if err != nil {
+		return "", err
+	}
+	if diff == "" {
+		return fmt.Sprintf("Data of %s event %s unchanged", event.Type(), event.ID()), nil
+	}
+	return fmt.Sprintf("Data diff of %s event %s:\n%s", event.Type(), event.ID(), strings.TrimSuffix(diff, "\n")), nil
+}
+
+// diffableData returns the data of the given event, decoded with sorted keys
+// when it is JSON so that diffs only show changed values.
+func diffableData(event cloudevents.Event) string {
+	if isJSONMediaType(event.DataMediaType()) {
+		if data, err := decodeJSON(event.Data()); err == nil {
+			return data
+		}
+	}
+	return string(event.Data())
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffRenderer(t *testing.T) {
+	r, err := newRenderer("compact", renderOptions{diff: true})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	first := newTestEvent(t)
+	want, err := compactRenderer{}.Render(first)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if got := render(t, r, first); got != want {
+		t.Errorf("Expected the first event to be rendered in full, got:\n%s", got)
+	}
+
+	second := newTestEvent(t)
+	second.SetID("second")
+	if err := second.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"id": 3, "label": ""}); err != nil {
+		t.Fatal(err)
+	}
+	want = `Data diff of dev.knative.eventing.samples.heartbeat event second:
+--- 2b72d7bf-c38f-4a98-a433-608fbcdd2596
++++ second
+@@ -1,4 +1,4 @@
+ {
+-  "id": 2,
++  "id": 3,
+   "label": ""
+ }`
+	if diff := cmp.Diff(want, render(t, r, second)); diff != "" {
+		t.Error("Unexpected diff (-want, +got):", diff)
+	}
+
+	third := newTestEvent(t)
+	third.SetID("third")
+	if err := third.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"label": "", "id": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := render(t, r, third), "Data of dev.knative.eventing.samples.heartbeat event third unchanged"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	other := newTestEvent(t)
+	other.SetType("dev.knative.eventing.samples.other")
+	if got := render(t, r, other); got == "" || got[0] != '{' {
+		t.Errorf("Expected the first event of another type to be rendered in full, got:\n%s", got)
+	}
+}
+
+func TestNewRenderer_DiffCSV(t *testing.T) {
+	if _, err := newRenderer("csv", renderOptions{diff: true}); err == nil {
+		t.Error("Expected an error for csv output displayed as diffs")
+	}
+}
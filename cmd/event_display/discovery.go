@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// eventKind identifies the kind of events discovered by DISCOVERY_MODE.
+type eventKind struct {
+	typ, source, contentType string
+}
+
+// discoveredKinds is the set of the kinds of events seen by discoverEvents. It
+// is safe for concurrent use.
+type discoveredKinds struct {
+	mu   sync.Mutex
+	seen map[eventKind]struct{}
+}
+
+func newDiscoveredKinds() *discoveredKinds {
+	return &discoveredKinds{seen: make(map[eventKind]struct{})}
+}
+
+// Add adds the kind of the given event to the set, and returns whether it
+// wasn't already seen.
+func (d *discoveredKinds) Add(event cloudevents.Event) bool {
+	kind := eventKind{typ: event.Type(), source: event.Source(), contentType: event.DataContentType()}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.seen[kind]; ok {
+		return false
+	}
+	d.seen[kind] = struct{}{}
+	return true
+}
+
+// discoverEvents returns an eventHandler which passes to next only the first
+// event of each type, source and data content type, as a sample of its
+// payload. Other events are acknowledged without being displayed, but are
+// counted as received nonetheless.
+func discoverEvents(kinds *discoveredKinds, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if !kinds.Add(event) {
+			eventsReceived.WithLabelValues(event.Type(), event.Source()).Inc()
+			return nil, nil
+		}
+		return next(ctx, event)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestRun_DiscoveryMode(t *testing.T) {
+	out := captureLog(t)
+	cfg := testConfig(t)
+	cfg.DiscoveryMode = true
+	cfg.OutputFormat = "compact"
+	stop := startRun(t, cfg)
+
+	heartbeat := newTestEvent(t)
+	text := newTestEvent(t)
+	if err := text.SetData("text/plain", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	other := newTestEvent(t)
+	other.SetSource("https://knative.dev/eventing/cmd/other")
+	events := []cloudevents.Event{heartbeat, heartbeat, text, other, text, heartbeat, other}
+	for i, event := range events {
+		event.SetID(strings.Repeat("x", i+1))
+		if res := sendEvent(t, event); !cloudevents.IsACK(res) {
+			t.Fatal("Failed to send event:", res)
+		}
+	}
+	stop()
+
+	var displayed []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, `"type": dev.knative.eventing.samples.heartbeat`) {
+			displayed = append(displayed, line)
+		}
+	}
+	// Once per kind: the heartbeat, the text event and the other source.
+	if len(displayed) != 3 {
+		t.Fatalf("Expected 3 displayed events, got:\n%s", strings.Join(displayed, "\n"))
+	}
+	all := strings.Join(displayed, "\n")
+	if got := strings.Count(all, "hello"); got != 1 {
+		t.Errorf("Expected the text event to be displayed once, got %d times:\n%s", got, all)
+	}
+	if got := strings.Count(all, `"source": "https://knative.dev/eventing/cmd/other"`); got != 1 {
+		t.Errorf("Expected the event of the other source to be displayed once, got %d times:\n%s", got, all)
+	}
+	if !strings.Contains(out.String(), "received 7 events") {
+		t.Errorf("Expected all the events to be received, got:\n%s", out)
+	}
+}
+
+func TestDiscoverEvents_SamplePayload(t *testing.T) {
+	var displayed []string
+	handler := discoverEvents(newDiscoveredKinds(), func(_ context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		displayed = append(displayed, string(event.Data()))
+		return nil, nil
+	})
+	for _, data := range []string{"first", "second"} {
+		event := newTestEvent(t)
+		if err := event.SetData("text/plain", data); err != nil {
+			t.Fatal(err)
+		}
+		if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+			t.Fatal("Expected event to be acknowledged, got:", res)
+		}
+	}
+	if len(displayed) != 1 || displayed[0] != "first" {
+		t.Error("Expected only the payload of the first event to be displayed, got:", displayed)
+	}
+}
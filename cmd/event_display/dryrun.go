@@ -0,0 +1,205 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/tracing/config"
+)
+
+// checkConfig returns an error if the given configuration fails to be applied,
+// beyond the checks of parseConfig: files must exist, URLs, JSON configs and
+// time zones must be valid, and features must be supported.
+func checkConfig(cfg Config) error {
+	if cfg.DataSchemaFile != "" {
+		if _, err := loadJSONSchema(cfg.DataSchemaFile); err != nil {
+			return fmt.Errorf("invalid data schema file: %w", err)
+		}
+	}
+	if _, err := standardStream(cfg.LogStream); err != nil {
+		return err
+	}
+	if _, err := standardStream(cfg.OutputStream); err != nil {
+		return err
+	}
+	if cfg.LogFilePath != "" && cfg.LogFilePath != "none" {
+		if _, err := os.Stat(filepath.Dir(cfg.LogFilePath)); err != nil {
+			return fmt.Errorf("invalid log file path: %w", err)
+		}
+	}
+	if cfg.ListenSocket != "" {
+		if _, err := os.Stat(filepath.Dir(cfg.ListenSocket)); err != nil {
+			return fmt.Errorf("invalid listen socket: %w", err)
+		}
+	}
+	if cfg.RouteByType {
+		if _, err := os.Stat(cfg.RouteDir); err != nil {
+			return fmt.Errorf("invalid route directory: %w", err)
+		}
+	}
+	if cfg.ReplayFile != "" {
+		if _, err := os.Stat(cfg.ReplayFile); err != nil {
+			return fmt.Errorf("invalid replay file: %w", err)
+		}
+		if cfg.Sink == "" {
+			return fmt.Errorf("K_SINK is required to replay events")
+		}
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		if _, err := newTLSConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile); err != nil {
+			return fmt.Errorf("invalid TLS config: %w", err)
+		}
+	}
+	sinks := cfg.Sinks
+	if cfg.Sink != "" {
+		sinks = append([]string{cfg.Sink}, sinks...)
+	}
+	routes, err := parseSinkRoutes(cfg.Route)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		sinks = append(sinks, route.sink)
+	}
+	for _, sink := range sinks {
+		if u, err := url.Parse(sink); err != nil || !u.IsAbs() {
+			return fmt.Errorf("invalid sink URL %q", sink)
+		}
+	}
+	if cfg.ConfigTracingPath != "" {
+		b, err := os.ReadFile(cfg.ConfigTracingPath)
+		if err != nil {
+			return fmt.Errorf("invalid tracing config path: %w", err)
+		}
+		if _, err := config.JSONToTracingConfig(string(b)); err != nil {
+			return fmt.Errorf("invalid tracing config file: %w", err)
+		}
+	} else if cfg.ConfigTracing != "" {
+		if _, err := config.JSONToTracingConfig(cfg.ConfigTracing); err != nil {
+			return fmt.Errorf("invalid tracing config: %w", err)
+		}
+	}
+	if cfg.DisplayTimezone != "" {
+		if _, err := time.LoadLocation(cfg.DisplayTimezone); err != nil {
+			return fmt.Errorf("invalid display time zone: %w", err)
+		}
+	}
+	if _, err := newRenderer(cfg.OutputFormat, renderOptions{diff: cfg.DiffMode}); err != nil {
+		return err
+	}
+	if cfg.Transform != "" {
+		if _, err := parseTransform(cfg.Transform); err != nil {
+			return fmt.Errorf("invalid transform: %w", err)
+		}
+	}
+	if _, err := parseExtensionFilter(cfg.FilterExtension); err != nil {
+		return err
+	}
+	if _, err := parseResponseHeaders(cfg.ResponseHeaders); err != nil {
+		return err
+	}
+	if _, err := parseForwardExtension(cfg.ForwardExtension); err != nil {
+		return err
+	}
+	if cfg.ExtractJSONPath != "" {
+		if _, err := newJSONPathExtractor(cfg.ExtractJSONPath); err != nil {
+			return fmt.Errorf("invalid JSONPath: %w", err)
+		}
+	}
+	return nil
+}
+
+// printConfig writes the given configuration to w as JSON, with secrets
+// redacted.
+func printConfig(w io.Writer, cfg Config) error {
+	b, err := json.MarshalIndent(redactConfig(cfg), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// urlPasswordRegexp matches the password of URLs, as the second group.
+var urlPasswordRegexp = regexp.MustCompile(`(://[^/:@,\s]*:)([^/@,\s]*)@`)
+
+// redactConfig returns the given configuration with its webhook secret and the
+// passwords of its URLs redacted.
+func redactConfig(cfg Config) Config {
+	if cfg.WebhookSecret != "" {
+		cfg.WebhookSecret = redactedValue
+	}
+	redact := func(s string) string {
+		return urlPasswordRegexp.ReplaceAllString(s, "${1}"+redactedValue+"@")
+	}
+	cfg.Sink = redact(cfg.Sink)
+	sinks := make([]string, len(cfg.Sinks))
+	for i, sink := range cfg.Sinks {
+		sinks[i] = redact(sink)
+	}
+	cfg.Sinks = sinks
+	cfg.Route = redact(cfg.Route)
+	cfg.OTLPEndpoint = redact(cfg.OTLPEndpoint)
+	return cfg
+}
+
+// logConfig logs a summary of the given configuration, with secrets redacted,
+// and the build information, to confirm what is running.
+func logConfig(logger *zap.Logger, cfg Config) {
+	cfg = redactConfig(cfg)
+	fields := []zap.Field{zap.String("protocol", cfg.Protocol)}
+	switch {
+	case cfg.ReplayFile != "":
+		fields = append(fields, zap.String("replayFile", cfg.ReplayFile))
+	case cfg.Protocol == "mqtt":
+		fields = append(fields, zap.String("mqttBroker", cfg.MQTTBroker), zap.String("mqttTopic", cfg.MQTTTopic))
+	case cfg.ListenSocket != "":
+		fields = append(fields, zap.String("listenSocket", cfg.ListenSocket))
+	case cfg.BindAddress != "":
+		fields = append(fields, zap.String("bindAddress", cfg.BindAddress))
+	default:
+		fields = append(fields, zap.Int("port", cfg.Port))
+	}
+	fields = append(fields,
+		zap.String("path", cfg.ReceiverPath),
+		zap.String("outputFormat", cfg.OutputFormat),
+		zap.Strings("filterTypePrefix", cfg.FilterTypePrefix),
+		zap.String("filterExtension", cfg.FilterExtension),
+		zap.Strings("allowedContentTypes", cfg.AllowedContentTypes),
+	)
+	sinks := cfg.Sinks
+	if cfg.Sink != "" {
+		sinks = append([]string{cfg.Sink}, sinks...)
+	}
+	fields = append(fields, zap.Strings("sinks", sinks), zap.String("route", cfg.Route))
+	if cfg.TracingBackend == "otel" {
+		fields = append(fields, zap.String("tracingBackend", cfg.TracingBackend), zap.String("otlpEndpoint", cfg.OTLPEndpoint))
+	}
+	if cfg.WebhookSecret != "" {
+		fields = append(fields, zap.String("webhookSecret", cfg.WebhookSecret))
+	}
+	logger.Info("Starting event_display", append(fields, buildInfo().Fields()...)...)
+}
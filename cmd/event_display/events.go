@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// HTTP path of the endpoint serving the last received events on the metrics
+// server.
+const eventsPath = "/events"
+
+// eventBuffer is a ring buffer holding the last received events. It is safe
+// for concurrent use.
+type eventBuffer struct {
+	mu     sync.RWMutex
+	events []cloudevents.Event
+	// Index of the oldest event, where the next event is written once the
+	// buffer is full.
+	next int
+	full bool
+}
+
+// newEventBuffer returns an eventBuffer holding at most size events.
+func newEventBuffer(size int) *eventBuffer {
+	return &eventBuffer{
+		events: make([]cloudevents.Event, size),
+	}
+}
+
+// Add adds the given event to the buffer, evicting the oldest event if the
+// buffer is full.
+func (b *eventBuffer) Add(event cloudevents.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.events[b.next] = event
+	b.next = (b.next + 1) % len(b.events)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Reset removes all the events from the buffer.
+func (b *eventBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range b.events {
+		b.events[i] = cloudevents.Event{}
+	}
+	b.next = 0
+	b.full = false
+}
+
+// Events returns the events in the buffer, from the oldest to the newest.
+func (b *eventBuffer) Events() []cloudevents.Event {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.full {
+		return append([]cloudevents.Event{}, b.events[:b.next]...)
+	}
+	events := make([]cloudevents.Event, 0, len(b.events))
+	events = append(events, b.events[b.next:]...)
+	return append(events, b.events[:b.next]...)
+}
+
+// bufferEvents returns an eventHandler which adds each event to the given
+// buffer before passing it to next.
+func bufferEvents(buffer *eventBuffer, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		buffer.Add(event)
+		return next(ctx, event)
+	}
+}
+
+// eventsMiddleware exposes the events of the given buffer as a JSON array.
+func eventsMiddleware(buffer *eventBuffer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != eventsPath {
+			next.ServeHTTP(w, req)
+			return
+		}
+		b, err := json.Marshal(buffer.Events())
+		if err != nil {
+			zap.L().Error("Failed to marshal events", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRun_EventsEndpoint(t *testing.T) {
+	startRun(t, testConfig(t))
+
+	var want []string
+	for i := 1; i <= 3; i++ {
+		event := newTestEvent(t)
+		event.SetID(strconv.Itoa(i))
+		sendEvent(t, event)
+		want = append(want, event.ID())
+	}
+
+	events := recentEvents(t)
+	var got []string
+	for _, event := range events {
+		got = append(got, event.ID())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("Unexpected events (-want, +got):", diff)
+	}
+}
+
+func TestEventBuffer(t *testing.T) {
+	b := newEventBuffer(3)
+
+	var got []string
+	for i := 1; i <= 5; i++ {
+		event := newTestEvent(t)
+		event.SetID(strconv.Itoa(i))
+		b.Add(event)
+	}
+	for _, event := range b.Events() {
+		got = append(got, event.ID())
+	}
+
+	if diff := cmp.Diff([]string{"3", "4", "5"}, got); diff != "" {
+		t.Error("Expected the oldest events to be evicted (-want, +got):", diff)
+	}
+}
+
+// recentEvents returns the events served by the events endpoint of the
+// metrics server.
+func recentEvents(t *testing.T) []cloudevents.Event {
+	t.Helper()
+
+	resp, err := http.Get("http://localhost:9090" + eventsPath)
+	if err != nil {
+		t.Fatal("Error getting events:", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	var events []cloudevents.Event
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatal("Error decoding events:", err)
+	}
+	return events
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"strings"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// jsonPathExtractor extracts a value from the JSON data of events. It is safe
+// for concurrent use.
+type jsonPathExtractor struct {
+	// Guards path, which keeps state while being evaluated.
+	mu   sync.Mutex
+	path *jsonpath.JSONPath
+}
+
+// newJSONPathExtractor returns an extractor of the value at the given JSONPath,
+// such as $.order.id. The braces of Kubernetes JSONPath templates, such as
+// {.order.id}, are optional.
+func newJSONPathExtractor(expr string) (*jsonPathExtractor, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + strings.TrimPrefix(expr, "$") + "}"
+	}
+	path := jsonpath.New("extract")
+	if err := path.Parse(expr); err != nil {
+		return nil, err
+	}
+	return &jsonPathExtractor{path: path}, nil
+}
+
+// Extract returns the values at the path in the data of the given event, and
+// whether any was found. Nothing is found in data which isn't JSON.
+func (e *jsonPathExtractor) Extract(event cloudevents.Event) ([]interface{}, bool) {
+	data := event.Data()
+	if mediaType, _, _ := mime.ParseMediaType(event.DataContentType()); len(data) == 0 || !isJSONMediaType(mediaType) {
+		return nil, false
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, false
+	}
+
+	e.mu.Lock()
+	results, err := e.path.FindResults(v)
+	e.mu.Unlock()
+	if err != nil {
+		// Missing fields aren't errors of the event.
+		return nil, false
+	}
+	var values []interface{}
+	for _, result := range results {
+		for _, r := range result {
+			values = append(values, r.Interface())
+		}
+	}
+	return values, len(values) > 0
+}
+
+// extractedKey is the context key of the log field of the values extracted
+// from the handled event.
+type extractedKey struct{}
+
+// extractJSONPath returns an eventHandler which extracts the values at the
+// path of the given extractor from the data of each event, to be logged with
+// its display by next.
+func extractJSONPath(e *jsonPathExtractor, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if values, ok := e.Extract(event); ok {
+			field := zap.Any("extracted", values)
+			if len(values) == 1 {
+				field = zap.Any("extracted", values[0])
+			}
+			ctx = context.WithValue(ctx, extractedKey{}, field)
+		}
+		return next(ctx, event)
+	}
+}
+
+// extractedFields returns the log field of the values extracted from the event
+// handled with ctx, if any.
+func extractedFields(ctx context.Context) []zap.Field {
+	field, ok := ctx.Value(extractedKey{}).(zap.Field)
+	if !ok {
+		return nil
+	}
+	return []zap.Field{field}
+}
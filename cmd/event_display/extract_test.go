@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+func TestExtractJSONPath(t *testing.T) {
+	order := newTestEvent(t)
+	if err := order.SetData(cloudevents.ApplicationJSON, map[string]interface{}{
+		"order": map[string]interface{}{"id": 12345, "items": []string{"book", "pen"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	text := newTestEvent(t)
+	if err := text.SetData("text/plain", `{"order": {"id": 12345}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		path  string
+		event cloudevents.Event
+		want  string
+	}{
+		"present path": {
+			path:  "$.order.id",
+			event: order,
+			want:  `"extracted": 12345`,
+		},
+		"several values": {
+			path:  "{.order.items[*]}",
+			event: order,
+			want:  `"extracted": ["book","pen"]`,
+		},
+		"missing path": {
+			path:  "$.order.customer",
+			event: order,
+		},
+		"non-JSON data": {
+			path:  "$.order.id",
+			event: text,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			extractor, err := newJSONPathExtractor(tc.path)
+			if err != nil {
+				t.Fatal("Error parsing JSONPath:", err)
+			}
+			out := captureLog(t)
+			handler := extractJSONPath(extractor, display(zap.L(), compactRenderer{}))
+			if _, res := handler(context.Background(), tc.event); !cloudevents.IsACK(res) {
+				t.Fatal("Expected event to be acknowledged, got:", res)
+			}
+
+			if tc.want == "" {
+				if strings.Contains(out.String(), `"extracted"`) {
+					t.Errorf("Expected nothing to be extracted, got:\n%s", out)
+				}
+			} else if !strings.Contains(out.String(), tc.want) {
+				t.Errorf("Expected %s to be logged, got:\n%s", tc.want, out)
+			}
+		})
+	}
+}
+
+func TestNewJSONPathExtractor_Invalid(t *testing.T) {
+	if _, err := newJSONPathExtractor("$.order[id"); err == nil {
+		t.Error("Expected an error parsing an invalid JSONPath")
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.uber.org/zap"
+)
+
+// filterTypePrefixes returns an eventHandler which passes to next only the
+// events whose type starts with one of the given prefixes. Other events are
+// acknowledged without being handled. All events are passed when no prefix is
+// given.
+func filterTypePrefixes(prefixes []string, next eventHandler) eventHandler {
+	if len(prefixes) == 0 {
+		return next
+	}
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(event.Type(), prefix) {
+				return next(ctx, event)
+			}
+		}
+		zap.L().Debug("Filtered out event", zap.String("type", event.Type()), zap.String("id", event.ID()))
+		eventsFiltered.WithLabelValues(event.Type()).Inc()
+		return nil, nil
+	}
+}
+
+// parseExtensionFilter parses a comma-separated list of key=value pairs
+// matched against the extensions of events.
+func parseExtensionFilter(s string) (map[string]string, error) {
+	match := make(map[string]string)
+	for _, pair := range splitList(s) {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("invalid extension filter %q, expected key=value", pair)
+		}
+		// Extension names are case-insensitive and stored lowercase.
+		match[strings.ToLower(key)] = strings.TrimSpace(value)
+	}
+	return match, nil
+}
+
+// filterExtensions returns an eventHandler which passes to next only the
+// events whose extensions have all the given values, compared as strings.
+// Other events are acknowledged without being handled. All events are passed
+// when no extension is given.
+func filterExtensions(match map[string]string, next eventHandler) eventHandler {
+	if len(match) == 0 {
+		return next
+	}
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		extensions := event.Context.GetExtensions()
+		for key, want := range match {
+			if value, ok := extensions[key]; !ok || fmt.Sprint(value) != want {
+				zap.L().Debug("Filtered out event", zap.String("type", event.Type()), zap.String("id", event.ID()))
+				eventsFiltered.WithLabelValues(event.Type()).Inc()
+				return nil, nil
+			}
+		}
+		return next(ctx, event)
+	}
+}
+
+// filterContentTypes returns an eventHandler which rejects with a 415 status
+// the events whose data content type isn't one of the given media types.
+// Events without data are always passed, and all events are passed when no
+// media type is given.
+func filterContentTypes(mediaTypes []string, next eventHandler) eventHandler {
+	if len(mediaTypes) == 0 {
+		return next
+	}
+	allowed := make(map[string]bool, len(mediaTypes))
+	for _, mediaType := range mediaTypes {
+		// Media types are case-insensitive.
+		allowed[strings.ToLower(mediaType)] = true
+	}
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if len(event.Data()) == 0 {
+			return next(ctx, event)
+		}
+		contentType := event.DataContentType()
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			mediaType = strings.ToLower(contentType)
+		}
+		if mediaType == "" {
+			// Data without a content type is JSON, as per the CloudEvents spec.
+			mediaType = cloudevents.ApplicationJSON
+		}
+		if !allowed[mediaType] {
+			return nil, cehttp.NewResult(http.StatusUnsupportedMediaType, "unsupported data content type %q", contentType)
+		}
+		return next(ctx, event)
+	}
+}
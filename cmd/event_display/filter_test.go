@@ -0,0 +1,189 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+func TestFilterTypePrefixes(t *testing.T) {
+	testCases := map[string]struct {
+		filter     string
+		eventType  string
+		wantPassed bool
+	}{
+		"matching prefix": {
+			filter:     "dev.knative.eventing.samples.",
+			eventType:  "dev.knative.eventing.samples.heartbeat",
+			wantPassed: true,
+		},
+		"one of several matching prefixes": {
+			filter:     "com.example., dev.knative.",
+			eventType:  "dev.knative.eventing.samples.heartbeat",
+			wantPassed: true,
+		},
+		"non-matching prefix": {
+			filter:     "com.example.,org.example.",
+			eventType:  "dev.knative.eventing.samples.heartbeat",
+			wantPassed: false,
+		},
+		"empty filter": {
+			filter:     "",
+			eventType:  "dev.knative.eventing.samples.heartbeat",
+			wantPassed: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			event := newTestEvent(t)
+			event.SetType(tc.eventType)
+
+			var passed bool
+			handler := filterTypePrefixes(splitList(tc.filter), func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+				passed = true
+				return nil, nil
+			})
+			if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+				t.Error("Expected event to be acknowledged, got:", res)
+			}
+
+			if passed != tc.wantPassed {
+				t.Errorf("Expected event to be passed: %t, got: %t", tc.wantPassed, passed)
+			}
+		})
+	}
+}
+
+func TestFilterExtensions(t *testing.T) {
+	testCases := map[string]struct {
+		filter     string
+		extensions map[string]interface{}
+		wantPassed bool
+	}{
+		"matching tenant": {
+			filter:     "tenant=acme",
+			extensions: map[string]interface{}{"tenant": "acme"},
+			wantPassed: true,
+		},
+		"non-matching tenant": {
+			filter:     "tenant=acme",
+			extensions: map[string]interface{}{"tenant": "globex"},
+			wantPassed: false,
+		},
+		"missing extension": {
+			filter:     "tenant=acme",
+			wantPassed: false,
+		},
+		"all pairs matching": {
+			filter:     "tenant=acme, beats=true",
+			extensions: map[string]interface{}{"tenant": "acme"},
+			wantPassed: true,
+		},
+		"one of several pairs not matching": {
+			filter:     "tenant=acme,beats=false",
+			extensions: map[string]interface{}{"tenant": "acme"},
+			wantPassed: false,
+		},
+		"empty filter": {
+			filter:     "",
+			wantPassed: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// The test event has a beats=true extension.
+			event := newTestEvent(t)
+			for key, value := range tc.extensions {
+				event.SetExtension(key, value)
+			}
+			match, err := parseExtensionFilter(tc.filter)
+			if err != nil {
+				t.Fatal("Error parsing filter:", err)
+			}
+
+			var passed bool
+			handler := filterExtensions(match, func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+				passed = true
+				return nil, nil
+			})
+			if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+				t.Error("Expected event to be acknowledged, got:", res)
+			}
+
+			if passed != tc.wantPassed {
+				t.Errorf("Expected event to be passed: %t, got: %t", tc.wantPassed, passed)
+			}
+		})
+	}
+}
+
+func TestParseExtensionFilter_Invalid(t *testing.T) {
+	for _, filter := range []string{"tenant", "=acme", "tenant=acme,region"} {
+		if _, err := parseExtensionFilter(filter); err == nil {
+			t.Errorf("Expected an error for filter %q", filter)
+		}
+	}
+}
+
+func TestFilterContentTypes(t *testing.T) {
+	testCases := map[string]struct {
+		contentType string
+		wantPassed  bool
+	}{
+		"allowed content type": {
+			contentType: "application/json",
+			wantPassed:  true,
+		},
+		"allowed content type with parameters": {
+			contentType: "Text/Plain; charset=utf-8",
+			wantPassed:  true,
+		},
+		"disallowed content type": {
+			contentType: "application/octet-stream",
+			wantPassed:  false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			event := newTestEvent(t)
+			event.SetDataContentType(tc.contentType)
+
+			var passed bool
+			handler := filterContentTypes(splitList("application/json,text/plain"), func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+				passed = true
+				return nil, nil
+			})
+			_, res := handler(context.Background(), event)
+
+			if passed != tc.wantPassed {
+				t.Errorf("Expected event to be passed: %t, got: %t", tc.wantPassed, passed)
+			}
+			var httpResult *cehttp.Result
+			if rejected := cloudevents.ResultAs(res, &httpResult) && httpResult.StatusCode == http.StatusUnsupportedMediaType; rejected == tc.wantPassed {
+				t.Errorf("Expected event to be rejected with a 415: %t, got: %v", !tc.wantPassed, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/observability/opencensus/v2/client"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.uber.org/zap"
+)
+
+// newForwardClient returns a CloudEvents client sending events to the given
+// sink through the proxy chosen by proxy, e.g. http.ProxyFromEnvironment. The
+// certificate of the sink isn't verified when insecureSkipVerify is set.
+//
+// The transport replaces the one decorated by the observed client, so it is
+// traced the same way. Each client has its own http.Client, as the protocol
+// would otherwise set its transport on http.DefaultClient, shared by the whole
+// process.
+func newForwardClient(sink string, insecureSkipVerify bool, proxy func(*http.Request) (*url.URL, error)) (cloudevents.Client, error) {
+	traced := &ochttp.Transport{
+		Propagation: &tracecontext.HTTPFormat{},
+		Base:        newForwardTransport(insecureSkipVerify, proxy),
+	}
+	return client.NewClientHTTP([]cehttp.Option{
+		cloudevents.WithTarget(sink),
+		cehttp.WithClient(http.Client{Transport: traced}),
+		cehttp.WithRoundTripper(traced),
+	}, nil)
+}
+
+// newForwardTransport returns the transport of requests to sinks, through the
+// proxy chosen by proxy, which doesn't verify the certificates of sinks when
+// insecureSkipVerify is set.
+func newForwardTransport(insecureSkipVerify bool, proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	if insecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec // Opt-in, for testing.
+	}
+	return transport
+}
+
+// sinkRoute forwards the events whose attribute matches a pattern to a sink.
+type sinkRoute struct {
+	// Name of a context attribute or an extension.
+	attribute string
+	pattern   *regexp.Regexp
+	sink      string
+	// Client sending events to the sink, set once the routes are parsed.
+	sender cloudevents.Client
+}
+
+// parseSinkRoutes parses a comma-separated list of attribute=regexp:URL
+// routes, e.g. type=order\..*:http://orders. Regular expressions must match
+// the whole attribute value, and can't contain commas.
+func parseSinkRoutes(s string) ([]sinkRoute, error) {
+	var routes []sinkRoute
+	for _, route := range splitList(s) {
+		attribute, rest, ok := strings.Cut(route, "=")
+		// The pattern ends at the colon preceding the scheme of the URL.
+		sep := -1
+		if scheme := strings.Index(rest, "://"); scheme >= 0 {
+			sep = strings.LastIndex(rest[:scheme], ":")
+		}
+		if attribute = strings.TrimSpace(attribute); !ok || attribute == "" || sep < 0 {
+			return nil, fmt.Errorf("invalid route %q, expected attribute=regexp:URL", route)
+		}
+		pattern, err := regexp.Compile("^(?:" + rest[:sep] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of route %q: %w", route, err)
+		}
+		routes = append(routes, sinkRoute{
+			// Extension names are case-insensitive and stored lowercase.
+			attribute: strings.ToLower(attribute),
+			pattern:   pattern,
+			sink:      rest[sep+1:],
+		})
+	}
+	return routes, nil
+}
+
+// forwardExtension is an extension set on forwarded events.
+type forwardExtension struct {
+	name  string
+	value string
+}
+
+// parseForwardExtension parses a name=value extension set on forwarded
+// events. No extension is set when s is empty.
+func parseForwardExtension(s string) (*forwardExtension, error) {
+	if s == "" {
+		return nil, nil
+	}
+	name, value, ok := strings.Cut(s, "=")
+	// Extension names are case-insensitive and stored lowercase.
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("invalid forward extension %q, expected name=value", s)
+	case isContextAttribute(name) || !event.IsExtensionNameValid(name):
+		return nil, fmt.Errorf("invalid forward extension name %q", name)
+	}
+	return &forwardExtension{name: name, value: strings.TrimSpace(value)}, nil
+}
+
+// Match returns whether the attribute of the given event matches the route.
+func (r sinkRoute) Match(event cloudevents.Event) bool {
+	var value string
+	switch r.attribute {
+	case "id":
+		value = event.ID()
+	case "type":
+		value = event.Type()
+	case "source":
+		value = event.Source()
+	case "subject":
+		value = event.Subject()
+	case "dataschema":
+		value = event.DataSchema()
+	case "datacontenttype":
+		value = event.DataContentType()
+	default:
+		v, ok := event.Extensions()[r.attribute]
+		if !ok {
+			return false
+		}
+		value = fmt.Sprint(v)
+	}
+	return r.pattern.MatchString(value)
+}
+
+// forwardOptions configures how events are forwarded.
+type forwardOptions struct {
+	// Whether events must be forwarded to at least one sink to be accepted.
+	required bool
+	// Maximum number of retries of failed sends, with exponential backoff
+	// from baseDelay. Retries are bound by the receive's context.
+	maxRetries int
+	baseDelay  time.Duration
+	// Timeout of the forwarding of each event to each sink, retries included,
+	// unlimited if not positive.
+	timeout time.Duration
+	// Routes of events to specific sinks, instead of the default ones. The
+	// first matching route is used.
+	routes []sinkRoute
+	// Extension set on forwarded events, not on the events passed to next,
+	// when not nil.
+	extension *forwardExtension
+}
+
+// forwardEvents returns an eventHandler which sends each event successfully
+// handled by next to downstream sinks concurrently, using the client of each
+// sink, by URL. Events matching a route are only sent to its sink. Forwarding
+// failures, timeouts included, are logged, and only fail the receive when
+// forwarding is required and the event fails to be forwarded to all sinks.
+// The extension of opts is set on a copy of each event, so that it is only
+// seen by sinks.
+func forwardEvents(senders map[string]cloudevents.Client, opts forwardOptions, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		reply, result := next(ctx, event)
+		if !cloudevents.IsACK(result) {
+			return reply, result
+		}
+
+		targets := senders
+		for _, route := range opts.routes {
+			if route.Match(event) {
+				targets = map[string]cloudevents.Client{route.sink: route.sender}
+				break
+			}
+		}
+
+		if opts.extension != nil {
+			event = event.Clone()
+			event.SetExtension(opts.extension.name, opts.extension.value)
+		}
+
+		sendCtx := ctx
+		if opts.maxRetries > 0 {
+			sendCtx = cloudevents.ContextWithRetriesExponentialBackoff(ctx, opts.baseDelay, opts.maxRetries)
+		}
+		var (
+			wg     sync.WaitGroup
+			mu     sync.Mutex
+			failed []string
+		)
+		for sink, sender := range targets {
+			wg.Add(1)
+			go func(sink string, sender cloudevents.Client) {
+				defer wg.Done()
+				ctx := sendCtx
+				if opts.timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+					defer cancel()
+				}
+				if res := sender.Send(ctx, event); !cloudevents.IsACK(res) {
+					if errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(sendCtx.Err(), context.DeadlineExceeded) {
+						forwardTimeouts.WithLabelValues().Inc()
+						res = fmt.Errorf("timed out after %v: %w", opts.timeout, res)
+					}
+					zap.L().Error("Failed to forward event", zap.String("id", event.ID()), zap.String("sink", sink), zap.Error(res))
+					mu.Lock()
+					failed = append(failed, fmt.Sprintf("%s: %v", sink, res))
+					mu.Unlock()
+				}
+			}(sink, sender)
+		}
+		wg.Wait()
+
+		if opts.required && len(failed) == len(targets) && len(failed) > 0 {
+			sort.Strings(failed)
+			return nil, cehttp.NewResult(http.StatusBadGateway, "failed to forward event: %s", strings.Join(failed, "; "))
+		}
+		return reply, result
+	}
+}
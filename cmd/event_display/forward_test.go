@@ -0,0 +1,360 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func TestForwardEvents(t *testing.T) {
+	received := make(chan cloudevents.Event, 1)
+	sink := newTestSink(t, http.StatusAccepted, received)
+
+	event := newTestEvent(t)
+	handler := forwardEvents(map[string]cloudevents.Client{sink.URL: newTestSender(t, sink.URL)}, forwardOptions{}, display(zap.L(), compactRenderer{}))
+	captureLog(t)
+	if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+		t.Fatal("Expected event to be acknowledged, got:", res)
+	}
+
+	select {
+	case got := <-received:
+		if diff := cmp.Diff(event.String(), got.String()); diff != "" {
+			t.Error("Unexpected forwarded event (-want, +got):", diff)
+		}
+	default:
+		t.Fatal("Event was not forwarded to the sink")
+	}
+}
+
+func TestForwardEvents_SinkFailure(t *testing.T) {
+	sink := newTestSink(t, http.StatusInternalServerError, nil)
+
+	for _, required := range []bool{false, true} {
+		handler := forwardEvents(map[string]cloudevents.Client{sink.URL: newTestSender(t, sink.URL)}, forwardOptions{required: required}, display(zap.L(), compactRenderer{}))
+		captureLog(t)
+		_, res := handler(context.Background(), newTestEvent(t))
+		if gotACK := cloudevents.IsACK(res); gotACK == required {
+			t.Errorf("With forwarding required: %t, expected ACK: %t, got: %v", required, !required, res)
+		}
+	}
+}
+
+func TestForwardEvents_FanOut(t *testing.T) {
+	received := make(chan cloudevents.Event, 1)
+	sink := newTestSink(t, http.StatusAccepted, received)
+	failing := newTestSink(t, http.StatusInternalServerError, nil)
+	senders := map[string]cloudevents.Client{
+		sink.URL:    newTestSender(t, sink.URL),
+		failing.URL: newTestSender(t, failing.URL),
+	}
+
+	for _, required := range []bool{false, true} {
+		handler := forwardEvents(senders, forwardOptions{required: required}, display(zap.L(), compactRenderer{}))
+		captureLog(t)
+		if _, res := handler(context.Background(), newTestEvent(t)); !cloudevents.IsACK(res) {
+			t.Errorf("With forwarding required: %t, expected a partial failure to be acknowledged, got: %v", required, res)
+		}
+
+		select {
+		case <-received:
+		default:
+			t.Errorf("With forwarding required: %t, event was not forwarded to the healthy sink", required)
+		}
+	}
+
+	otherFailing := newTestSink(t, http.StatusServiceUnavailable, nil)
+	delete(senders, sink.URL)
+	senders[otherFailing.URL] = newTestSender(t, otherFailing.URL)
+	handler := forwardEvents(senders, forwardOptions{required: true}, display(zap.L(), compactRenderer{}))
+	captureLog(t)
+	if _, res := handler(context.Background(), newTestEvent(t)); cloudevents.IsACK(res) {
+		t.Error("Expected event failing to be forwarded to all sinks to be rejected")
+	}
+}
+
+func TestForwardEvents_Retries(t *testing.T) {
+	attempts := atomic.NewInt32(0)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if attempts.Inc() <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(sink.Close)
+
+	opts := forwardOptions{required: true, maxRetries: 3, baseDelay: time.Millisecond}
+	handler := forwardEvents(map[string]cloudevents.Client{sink.URL: newTestSender(t, sink.URL)}, opts, display(zap.L(), compactRenderer{}))
+	captureLog(t)
+	if _, res := handler(context.Background(), newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Error("Expected event to be eventually forwarded, got:", res)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Error("Expected event to be forwarded after 3 attempts, got", got)
+	}
+}
+
+func TestForwardEvents_Timeout(t *testing.T) {
+	unblock := make(chan struct{})
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-unblock:
+		case <-req.Context().Done():
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(sink.Close)
+	t.Cleanup(func() { close(unblock) })
+	timeoutsBefore := counterValue(t, "forward_timeouts_total", nil)
+
+	opts := forwardOptions{required: true, timeout: 50 * time.Millisecond}
+	handler := forwardEvents(map[string]cloudevents.Client{sink.URL: newTestSender(t, sink.URL)}, opts, display(zap.L(), compactRenderer{}))
+	out := captureLog(t)
+	start := time.Now()
+	if _, res := handler(context.Background(), newTestEvent(t)); cloudevents.IsACK(res) {
+		t.Error("Expected event failing to be forwarded in time to be rejected")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("Expected forwarding to be aborted after the timeout, took", elapsed)
+	}
+	if got := counterValue(t, "forward_timeouts_total", nil) - timeoutsBefore; got != 1 {
+		t.Error("Expected 1 forward timeout to be counted, got", got)
+	}
+	if !strings.Contains(out.String(), "timed out after 50ms") {
+		t.Errorf("Expected the timeout to be logged, got:\n%s", out)
+	}
+}
+
+func TestForwardEvents_Extension(t *testing.T) {
+	received := make(chan cloudevents.Event, 1)
+	sink := newTestSink(t, http.StatusAccepted, received)
+
+	var displayed cloudevents.Event
+	next := func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		displayed = event
+		return nil, nil
+	}
+	opts := forwardOptions{extension: &forwardExtension{name: "forwardedby", value: "event_display"}}
+	handler := forwardEvents(map[string]cloudevents.Client{sink.URL: newTestSender(t, sink.URL)}, opts, next)
+	captureLog(t)
+	event := newTestEvent(t)
+	if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+		t.Fatal("Expected event to be acknowledged, got:", res)
+	}
+
+	select {
+	case got := <-received:
+		if v := got.Extensions()["forwardedby"]; v != "event_display" {
+			t.Errorf("Expected forwarded event to have the extension forwardedby=event_display, got %v", v)
+		}
+	default:
+		t.Fatal("Event was not forwarded to the sink")
+	}
+	for name, e := range map[string]cloudevents.Event{"original": event, "displayed": displayed} {
+		if _, ok := e.Extensions()["forwardedby"]; ok {
+			t.Errorf("Expected %s event not to have the forwardedby extension", name)
+		}
+	}
+}
+
+func TestParseForwardExtension(t *testing.T) {
+	got, err := parseForwardExtension(" ForwardedBy = event_display ")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if want := (forwardExtension{name: "forwardedby", value: "event_display"}); *got != want {
+		t.Errorf("Expected %+v, got %+v", want, *got)
+	}
+
+	for _, invalid := range []string{"forwardedby", "=event_display", "forwarded_by=event_display", "source=event_display"} {
+		if _, err := parseForwardExtension(invalid); err == nil {
+			t.Errorf("Expected an error for extension %q", invalid)
+		}
+	}
+}
+
+func TestForwardEvents_Routes(t *testing.T) {
+	orders := make(chan cloudevents.Event, 1)
+	ordersSink := newTestSink(t, http.StatusAccepted, orders)
+	payments := make(chan cloudevents.Event, 1)
+	paymentsSink := newTestSink(t, http.StatusAccepted, payments)
+	others := make(chan cloudevents.Event, 1)
+	defaultSink := newTestSink(t, http.StatusAccepted, others)
+
+	routes, err := parseSinkRoutes("type=order\\..*:" + ordersSink.URL + ", type=payment\\..*:" + paymentsSink.URL)
+	if err != nil {
+		t.Fatal("Error parsing routes:", err)
+	}
+	for i := range routes {
+		routes[i].sender = newTestSender(t, routes[i].sink)
+	}
+	senders := map[string]cloudevents.Client{defaultSink.URL: newTestSender(t, defaultSink.URL)}
+	handler := forwardEvents(senders, forwardOptions{routes: routes}, display(zap.L(), compactRenderer{}))
+	captureLog(t)
+
+	for sink, tc := range map[string]struct {
+		eventType string
+		received  chan cloudevents.Event
+	}{
+		"orders":   {eventType: "order.created", received: orders},
+		"payments": {eventType: "payment.settled", received: payments},
+		"default":  {eventType: "orderly.created", received: others},
+	} {
+		event := newTestEvent(t)
+		event.SetType(tc.eventType)
+		if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+			t.Fatal("Expected event to be acknowledged, got:", res)
+		}
+		select {
+		case got := <-tc.received:
+			if got.Type() != tc.eventType {
+				t.Errorf("Expected event of type %s to be forwarded to the %s sink, got type %s", tc.eventType, sink, got.Type())
+			}
+		default:
+			t.Errorf("Event of type %s was not forwarded to the %s sink", tc.eventType, sink)
+		}
+	}
+	if len(orders)+len(payments)+len(others) != 0 {
+		t.Error("Expected each event to be forwarded to a single sink")
+	}
+}
+
+func TestParseSinkRoutes(t *testing.T) {
+	routes, err := parseSinkRoutes("type=order.*:http://orders:8080/in, Source=/shop/[a-z]+:https://shop")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	got := make([][]string, 0, len(routes))
+	for _, r := range routes {
+		got = append(got, []string{r.attribute, r.pattern.String(), r.sink})
+	}
+	want := [][]string{
+		{"type", "^(?:order.*)$", "http://orders:8080/in"},
+		{"source", "^(?:/shop/[a-z]+)$", "https://shop"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("Unexpected routes (-want, +got):", diff)
+	}
+
+	for _, invalid := range []string{"type=order.*", "order.*:http://orders", "=order:http://orders", "type=order[:http://orders"} {
+		if _, err := parseSinkRoutes(invalid); err == nil {
+			t.Errorf("Expected an error for route %q", invalid)
+		}
+	}
+}
+
+func TestNewForwardClient_DefaultClientUnchanged(t *testing.T) {
+	before := http.DefaultClient.Transport
+	if _, err := newForwardClient("https://sink.example.com", true, http.ProxyFromEnvironment); err != nil {
+		t.Fatal("Error creating forwarding client:", err)
+	}
+	if http.DefaultClient.Transport != before {
+		t.Error("Expected the transport of http.DefaultClient to be left unchanged")
+	}
+}
+
+func TestNewForwardClient_Proxy(t *testing.T) {
+	received := make(chan cloudevents.Event, 1)
+	sink := newTestSink(t, http.StatusAccepted, received)
+
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied <- req.URL.String()
+		req.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	t.Cleanup(proxy.Close)
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := newForwardClient(sink.URL, false, http.ProxyURL(proxyURL))
+	if err != nil {
+		t.Fatal("Error creating forwarding client:", err)
+	}
+	if res := sender.Send(context.Background(), newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Fatal("Expected event to be forwarded, got:", res)
+	}
+
+	select {
+	case got := <-proxied:
+		if !strings.HasPrefix(got, sink.URL) {
+			t.Errorf("Expected the proxy to receive a request for %s, got %s", sink.URL, got)
+		}
+	default:
+		t.Fatal("Event was not forwarded through the proxy")
+	}
+	select {
+	case <-received:
+	default:
+		t.Fatal("Event was not relayed to the sink")
+	}
+}
+
+// newTestSink returns a server which responds to CloudEvents with the given
+// status code, and sends them to received when it isn't nil.
+func newTestSink(t *testing.T, status int, received chan<- cloudevents.Event) *httptest.Server {
+	t.Helper()
+
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		event, err := cehttp.NewEventFromHTTPRequest(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if received != nil {
+			received <- *event
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(sink.Close)
+	return sink
+}
+
+// newTestSender returns a CloudEvents client which sends events to the given
+// target.
+func newTestSender(t *testing.T, target string) cloudevents.Client {
+	t.Helper()
+
+	// Sends through its own http.Client, rather than http.DefaultClient, which
+	// may be used concurrently by the tested code.
+	c, err := cloudevents.NewClientHTTP(cloudevents.WithTarget(target), cehttp.WithClient(http.Client{}))
+	if err != nil {
+		t.Fatal("Error creating CloudEvents client:", err)
+	}
+	return c
+}
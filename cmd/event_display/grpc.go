@@ -0,0 +1,566 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Name of the gRPC service receiving events when PROTOCOL is grpc, defined as:
+//
+//	service EventDisplay {
+//	  rpc Receive(io.cloudevents.v1.CloudEvent) returns (google.protobuf.Empty);
+//	}
+//
+// Events are encoded in the protobuf format of the CloudEvents spec. The code
+// generated from its schema isn't a dependency of this module, so events are
+// encoded by protoEventCodec instead.
+const grpcServiceName = "event_display.v1.EventDisplay"
+
+// grpcReceiveMethod is the full name of the method receiving events.
+const grpcReceiveMethod = "/" + grpcServiceName + "/Receive"
+
+// grpcReceiverServer is the server of the EventDisplay service.
+type grpcReceiverServer interface {
+	Receive(context.Context, cloudevents.Event) error
+}
+
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*grpcReceiverServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Receive",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			var event cloudevents.Event
+			if err := dec(&event); err != nil {
+				// Messages which can't be decoded are malformed, rather
+				// than internal errors as reported by gRPC.
+				return nil, status.Error(codes.InvalidArgument, status.Convert(err).Message())
+			}
+			receive := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &emptyMessage{}, srv.(grpcReceiverServer).Receive(ctx, *req.(*cloudevents.Event))
+			}
+			if interceptor == nil {
+				return receive(ctx, &event)
+			}
+			return interceptor(ctx, &event, &grpc.UnaryServerInfo{Server: srv, FullMethod: grpcReceiveMethod}, receive)
+		},
+	}},
+}
+
+// grpcReceiver passes the events received by the EventDisplay service to its
+// handler.
+type grpcReceiver struct {
+	handler eventHandler
+}
+
+// Receive rejects invalid events, and passes the others to the handler. Reply
+// events are discarded, the service has no response.
+func (r grpcReceiver) Receive(ctx context.Context, event cloudevents.Event) error {
+	if err := event.Validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, res := r.handler(ctx, event); !cloudevents.IsACK(res) {
+		return status.Error(grpcCode(res), res.Error())
+	}
+	return nil
+}
+
+// grpcCode returns the gRPC status code matching the given NACK result.
+func grpcCode(res cloudevents.Result) codes.Code {
+	var httpResult *cehttp.Result
+	if !cloudevents.ResultAs(res, &httpResult) {
+		return codes.Internal
+	}
+	switch httpResult.StatusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// serveGRPC passes the events received on l by the EventDisplay service to
+// handler, until ctx is cancelled.
+func serveGRPC(ctx context.Context, l net.Listener, handler eventHandler) error {
+	srv := grpc.NewServer(grpc.ForceServerCodec(protoEventCodec{}))
+	srv.RegisterService(&grpcServiceDesc, grpcReceiver{handler: handler})
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+	return srv.Serve(l)
+}
+
+// emptyMessage is a google.protobuf.Empty message.
+type emptyMessage struct{}
+
+// protoEventCodec is a gRPC codec of Event, encoded as an
+// io.cloudevents.v1.CloudEvent message, and of emptyMessage.
+type protoEventCodec struct{}
+
+func (protoEventCodec) Name() string {
+	// The messages are protobuf messages.
+	return "proto"
+}
+
+func (protoEventCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case *cloudevents.Event:
+		return marshalProtoEvent(*v)
+	case *emptyMessage:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported message type %T", v)
+	}
+}
+
+func (protoEventCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *cloudevents.Event:
+		event, err := unmarshalProtoEvent(data)
+		if err != nil {
+			return err
+		}
+		*v = event
+		return nil
+	case *emptyMessage:
+		// Unknown fields are ignored.
+		return nil
+	default:
+		return fmt.Errorf("unsupported message type %T", v)
+	}
+}
+
+// Field numbers of the io.cloudevents.v1.CloudEvent message.
+const (
+	protoEventID          protowire.Number = 1
+	protoEventSource      protowire.Number = 2
+	protoEventSpecVersion protowire.Number = 3
+	protoEventType        protowire.Number = 4
+	protoEventAttributes  protowire.Number = 5
+	protoEventBinaryData  protowire.Number = 6
+	protoEventTextData    protowire.Number = 7
+	protoEventProtoData   protowire.Number = 8
+)
+
+// Field numbers of the CloudEventAttributeValue message.
+const (
+	protoAttrBoolean   protowire.Number = 1
+	protoAttrInteger   protowire.Number = 2
+	protoAttrString    protowire.Number = 3
+	protoAttrBytes     protowire.Number = 4
+	protoAttrURI       protowire.Number = 5
+	protoAttrURIRef    protowire.Number = 6
+	protoAttrTimestamp protowire.Number = 7
+)
+
+// marshalProtoEvent encodes an Event as an io.cloudevents.v1.CloudEvent
+// message. Textual data is encoded as text_data, other data as binary_data.
+func marshalProtoEvent(event cloudevents.Event) ([]byte, error) {
+	var b []byte
+	appendString := func(num protowire.Number, s string) {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	appendString(protoEventID, event.ID())
+	appendString(protoEventSource, event.Source())
+	appendString(protoEventSpecVersion, event.SpecVersion())
+	appendString(protoEventType, event.Type())
+
+	attributes := make(map[string]interface{}, len(event.Extensions())+4)
+	for name, value := range event.Extensions() {
+		attributes[name] = value
+	}
+	if contentType := event.DataContentType(); contentType != "" {
+		attributes["datacontenttype"] = contentType
+	}
+	if schema := event.DataSchema(); schema != "" {
+		if uri := types.ParseURI(schema); uri != nil {
+			attributes["dataschema"] = *uri
+		} else {
+			attributes["dataschema"] = schema
+		}
+	}
+	if subject := event.Subject(); subject != "" {
+		attributes["subject"] = subject
+	}
+	if t := event.Time(); !t.IsZero() {
+		attributes["time"] = types.Timestamp{Time: t}
+	}
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := marshalProtoAttribute(attributes[name])
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", name, err)
+		}
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, value)
+		b = protowire.AppendTag(b, protoEventAttributes, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	if data := event.Data(); len(data) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(event.DataContentType())
+		if isJSONMediaType(mediaType) || strings.HasPrefix(mediaType, "text/") {
+			appendString(protoEventTextData, string(data))
+		} else {
+			b = protowire.AppendTag(b, protoEventBinaryData, protowire.BytesType)
+			b = protowire.AppendBytes(b, data)
+		}
+	}
+	return b, nil
+}
+
+// marshalProtoAttribute encodes an attribute value, of one of the CloudEvents
+// types, as a CloudEventAttributeValue message.
+func marshalProtoAttribute(value interface{}) ([]byte, error) {
+	var b []byte
+	switch v := value.(type) {
+	case bool:
+		b = protowire.AppendTag(b, protoAttrBoolean, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case int32:
+		b = protowire.AppendTag(b, protoAttrInteger, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v))
+	case string:
+		b = protowire.AppendTag(b, protoAttrString, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case []byte:
+		b = protowire.AppendTag(b, protoAttrBytes, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	case types.URI:
+		b = protowire.AppendTag(b, protoAttrURI, protowire.BytesType)
+		b = protowire.AppendString(b, v.String())
+	case types.URIRef:
+		b = protowire.AppendTag(b, protoAttrURIRef, protowire.BytesType)
+		b = protowire.AppendString(b, v.String())
+	case types.Timestamp:
+		var ts []byte
+		ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(v.Unix()))
+		ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(v.Nanosecond()))
+		b = protowire.AppendTag(b, protoAttrTimestamp, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", value)
+	}
+	return b, nil
+}
+
+// unmarshalProtoEvent decodes an io.cloudevents.v1.CloudEvent message. Data
+// of proto_data is the value of the google.protobuf.Any message. Binary data
+// is base64-encoded when the event is marshaled to JSON.
+func unmarshalProtoEvent(b []byte) (cloudevents.Event, error) {
+	var (
+		id, source, specVersion, typ string
+		attributes                   = make(map[string]interface{})
+		data                         []byte
+		binary                       bool
+	)
+	for len(b) > 0 {
+		num, wtyp, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return cloudevents.Event{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if num < protoEventID || num > protoEventProtoData {
+			// Unknown fields are skipped.
+			if n = protowire.ConsumeFieldValue(num, wtyp, b); n < 0 {
+				return cloudevents.Event{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		if wtyp != protowire.BytesType {
+			return cloudevents.Event{}, fmt.Errorf("unexpected wire type %d of field %d", wtyp, num)
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return cloudevents.Event{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch num {
+		case protoEventID:
+			id = string(v)
+		case protoEventSource:
+			source = string(v)
+		case protoEventSpecVersion:
+			specVersion = string(v)
+		case protoEventType:
+			typ = string(v)
+		case protoEventAttributes:
+			name, value, err := unmarshalProtoAttributeEntry(v)
+			if err != nil {
+				return cloudevents.Event{}, err
+			}
+			attributes[name] = value
+		case protoEventBinaryData, protoEventTextData:
+			data, binary = v, num == protoEventBinaryData
+		case protoEventProtoData:
+			value, err := unmarshalProtoAnyValue(v)
+			if err != nil {
+				return cloudevents.Event{}, err
+			}
+			data, binary = value, true
+			if _, ok := attributes["datacontenttype"]; !ok {
+				attributes["datacontenttype"] = "application/protobuf"
+			}
+		}
+	}
+
+	// The event has no context to set the attributes on otherwise.
+	if specVersion != cloudevents.VersionV1 && specVersion != cloudevents.VersionV03 {
+		return cloudevents.Event{}, fmt.Errorf("unknown specversion %q", specVersion)
+	}
+	event := cloudevents.NewEvent(specVersion)
+	event.SetID(id)
+	event.SetSource(source)
+	event.SetType(typ)
+	for name, value := range attributes {
+		if err := setProtoAttribute(&event, name, value); err != nil {
+			return cloudevents.Event{}, fmt.Errorf("attribute %q: %w", name, err)
+		}
+	}
+	if len(data) > 0 {
+		event.DataEncoded = data
+		event.DataBase64 = binary
+	}
+	return event, nil
+}
+
+// setProtoAttribute sets an attribute decoded from a CloudEventAttributeValue
+// message on the given event.
+func setProtoAttribute(event *cloudevents.Event, name string, value interface{}) error {
+	switch name {
+	case "datacontenttype":
+		s, err := types.ToString(value)
+		if err != nil {
+			return err
+		}
+		return event.Context.SetDataContentType(s)
+	case "dataschema":
+		uri, err := types.ToURL(value)
+		if err != nil {
+			return err
+		}
+		return event.Context.SetDataSchema(uri.String())
+	case "subject":
+		s, err := types.ToString(value)
+		if err != nil {
+			return err
+		}
+		return event.Context.SetSubject(s)
+	case "time":
+		t, err := types.ToTime(value)
+		if err != nil {
+			return err
+		}
+		return event.Context.SetTime(t)
+	default:
+		return event.Context.SetExtension(name, value)
+	}
+}
+
+// unmarshalProtoAttributeEntry decodes an entry of the attributes of an
+// io.cloudevents.v1.CloudEvent message.
+func unmarshalProtoAttributeEntry(b []byte) (string, interface{}, error) {
+	var (
+		name  string
+		value interface{}
+	)
+	for len(b) > 0 {
+		num, wtyp, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if wtyp != protowire.BytesType || num != 1 && num != 2 {
+			if n = protowire.ConsumeFieldValue(num, wtyp, b); n < 0 {
+				return "", nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return "", nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if num == 1 {
+			name = string(v)
+			continue
+		}
+		var err error
+		if value, err = unmarshalProtoAttribute(v); err != nil {
+			return "", nil, err
+		}
+	}
+	if value == nil {
+		return "", nil, fmt.Errorf("missing value of attribute %q", name)
+	}
+	return name, value, nil
+}
+
+// unmarshalProtoAttribute decodes a CloudEventAttributeValue message.
+func unmarshalProtoAttribute(b []byte) (interface{}, error) {
+	var value interface{}
+	for len(b) > 0 {
+		num, wtyp, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case wtyp == protowire.VarintType && (num == protoAttrBoolean || num == protoAttrInteger):
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			if num == protoAttrBoolean {
+				value = protowire.DecodeBool(v)
+			} else {
+				value = int32(v)
+			}
+		case wtyp == protowire.BytesType && num >= protoAttrString && num <= protoAttrTimestamp:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			var err error
+			if value, err = decodeProtoAttribute(num, v); err != nil {
+				return nil, err
+			}
+		default:
+			if n = protowire.ConsumeFieldValue(num, wtyp, b); n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return value, nil
+}
+
+// decodeProtoAttribute decodes the length-delimited field of the given number
+// of a CloudEventAttributeValue message.
+func decodeProtoAttribute(num protowire.Number, v []byte) (interface{}, error) {
+	switch num {
+	case protoAttrString:
+		return string(v), nil
+	case protoAttrBytes:
+		return append([]byte(nil), v...), nil
+	case protoAttrURI:
+		uri := types.ParseURI(string(v))
+		if uri == nil {
+			return nil, fmt.Errorf("invalid URI %q", v)
+		}
+		return *uri, nil
+	case protoAttrURIRef:
+		ref := types.ParseURIRef(string(v))
+		if ref == nil {
+			return nil, fmt.Errorf("invalid URI reference %q", v)
+		}
+		return *ref, nil
+	default:
+		return unmarshalProtoTimestamp(v)
+	}
+}
+
+// unmarshalProtoTimestamp decodes a google.protobuf.Timestamp message.
+func unmarshalProtoTimestamp(b []byte) (types.Timestamp, error) {
+	var seconds, nanos int64
+	for len(b) > 0 {
+		num, wtyp, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return types.Timestamp{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if wtyp != protowire.VarintType || num != 1 && num != 2 {
+			if n = protowire.ConsumeFieldValue(num, wtyp, b); n < 0 {
+				return types.Timestamp{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return types.Timestamp{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if num == 1 {
+			seconds = int64(v)
+		} else {
+			nanos = int64(int32(v))
+		}
+	}
+	return types.Timestamp{Time: time.Unix(seconds, nanos).UTC()}, nil
+}
+
+// unmarshalProtoAnyValue returns the value of a google.protobuf.Any message.
+func unmarshalProtoAnyValue(b []byte) ([]byte, error) {
+	var value []byte
+	for len(b) > 0 {
+		num, wtyp, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if n = protowire.ConsumeFieldValue(num, wtyp, b); n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		if num == 2 && wtyp == protowire.BytesType {
+			v, _ := protowire.ConsumeBytes(b)
+			value = v
+		}
+		b = b[n:]
+	}
+	if value == nil {
+		return nil, errors.New("missing value of proto_data")
+	}
+	return value, nil
+}
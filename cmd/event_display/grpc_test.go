@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/phayes/freeport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestProtoEventCodec(t *testing.T) {
+	event := newTestEvent(t)
+	event.SetSubject("beat")
+	event.SetDataSchema("https://knative.dev/schemas/heartbeat.json")
+	event.SetExtension("sequence", 42)
+	event.SetExtension("origin", types.ParseURIRef("/heartbeats"))
+	event.SetExtension("digest", []byte{0xca, 0xfe})
+	event.SetExtension("sent", time.Date(2019, 10, 18, 15, 23, 21, 500, time.UTC))
+	binary := newTestEvent(t)
+	binary.SetData("application/octet-stream", []byte{0, 1, 2})
+
+	for name, want := range map[string]cloudevents.Event{"text": event, "binary": binary} {
+		t.Run(name, func(t *testing.T) {
+			b, err := protoEventCodec{}.Marshal(&want)
+			if err != nil {
+				t.Fatal("Error marshaling event:", err)
+			}
+			var got cloudevents.Event
+			if err := (protoEventCodec{}).Unmarshal(b, &got); err != nil {
+				t.Fatal("Error unmarshaling event:", err)
+			}
+			if diff := cmp.Diff(want.String(), got.String()); diff != "" {
+				t.Error("Unexpected event (-want, +got):", diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshalProtoEvent_SpecVersion(t *testing.T) {
+	for name, specVersion := range map[string]string{"missing": "", "unknown": "2.0"} {
+		t.Run(name, func(t *testing.T) {
+			b := protoEventMessage(specVersion)
+			if _, err := unmarshalProtoEvent(b); err == nil || !strings.Contains(err.Error(), "specversion") {
+				t.Error("Expected an invalid specversion error, got:", err)
+			}
+		})
+	}
+}
+
+// protoEventMessage returns an io.cloudevents.v1.CloudEvent message with the
+// given specversion, omitted when empty.
+func protoEventMessage(specVersion string) []byte {
+	b := protowire.AppendTag(nil, protoEventID, protowire.BytesType)
+	b = protowire.AppendString(b, "1")
+	if specVersion != "" {
+		b = protowire.AppendTag(b, protoEventSpecVersion, protowire.BytesType)
+		b = protowire.AppendString(b, specVersion)
+	}
+	return b
+}
+
+// rawProtoCodec is a gRPC codec sending messages already encoded as bytes.
+type rawProtoCodec struct{ protoEventCodec }
+
+func (c rawProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+	return c.protoEventCodec.Marshal(v)
+}
+
+func TestRun_GRPC(t *testing.T) {
+	out := captureLog(t)
+	port, err := freeport.GetFreePort()
+	if err != nil {
+		t.Fatal("Error getting a free port:", err)
+	}
+	cfg := testConfig(t)
+	cfg.Protocol = "grpc"
+	cfg.Port = port
+	cfg.OutputFormat = "compact"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx, cfg)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	conn, err := grpc.DialContext(ctx, net.JoinHostPort("localhost", strconv.Itoa(port)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// Retry connecting quickly while the server starts.
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.Config{BaseDelay: 5 * time.Millisecond, Multiplier: 1, MaxDelay: 5 * time.Millisecond}}),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(protoEventCodec{}), grpc.WaitForReady(true)))
+	if err != nil {
+		t.Fatal("Error dialing gRPC server:", err)
+	}
+	defer conn.Close()
+
+	event := newTestEvent(t)
+	event.SetType("dev.knative.eventing.test.grpc")
+	if err := conn.Invoke(ctx, grpcReceiveMethod, &event, &emptyMessage{}); err != nil {
+		t.Fatal("Error sending event:", err)
+	}
+	// Missing its required attributes.
+	invalid := cloudevents.NewEvent()
+	if err := conn.Invoke(ctx, grpcReceiveMethod, &invalid, &emptyMessage{}); status.Code(err) != codes.InvalidArgument {
+		t.Error("Expected an invalid event to be rejected, got:", err)
+	}
+	// Without specversion, the message can't be decoded into an event.
+	if err := conn.Invoke(ctx, grpcReceiveMethod, protoEventMessage(""), &emptyMessage{}, grpc.ForceCodec(rawProtoCodec{})); status.Code(err) != codes.InvalidArgument {
+		t.Error("Expected an event without specversion to be rejected, got:", err)
+	}
+
+	cancel()
+	<-done
+	if !strings.Contains(out.String(), `"type": dev.knative.eventing.test.grpc`) {
+		t.Errorf("Expected the event to be displayed, got:\n%s", out)
+	}
+	if !strings.Contains(out.String(), "received 1 events") {
+		t.Errorf("Expected 1 received event, got:\n%s", out)
+	}
+}
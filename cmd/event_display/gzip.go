@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// gzipMiddleware returns a cehttp.Middleware which decompresses gzip-encoded
+// request bodies, so that events are parsed from the decoded body. Bodies that
+// aren't valid gzip are rejected with a 400, and bodies decompressing to more
+// than max bytes with a 413.
+func gzipMiddleware(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !strings.EqualFold(req.Header.Get("Content-Encoding"), "gzip") {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			body, err := gunzip(req.Body, max)
+			_ = req.Body.Close()
+			if errors.Is(err, errBodyTooLarge) {
+				zap.L().Warn("Rejected request body", zap.Error(err))
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				zap.L().Error("Failed to decompress request body", zap.Error(err))
+				http.Error(w, "malformed gzip body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// Replace the body with a new reader of the decoded content
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+			req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			req.Header.Del("Content-Encoding")
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// errBodyTooLarge is returned by gunzip for content larger than its maximum.
+var errBodyTooLarge = errors.New("decompressed body too large")
+
+// gunzip returns the decompressed content of r, or errBodyTooLarge if it is
+// larger than max bytes, without reading more than max+1 bytes of it.
+func gunzip(r io.Reader, max int64) ([]byte, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	body, err := io.ReadAll(io.LimitReader(zr, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > max {
+		return nil, fmt.Errorf("%w, more than %d bytes", errBodyTooLarge, max)
+	}
+	return body, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRun_GzipBody(t *testing.T) {
+	out := captureLog(t)
+	startRun(t, testConfig(t))
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write([]byte(`{"specversion":"1.0","id":"1","type":"dev.knative.eventing.samples.heartbeat",` +
+		`"source":"https://knative.dev/eventing/cmd/heartbeats","datacontenttype":"application/json",` +
+		`"data":{"label":"compressed"}}`))
+	if err := zw.Close(); err != nil {
+		t.Fatal("Error compressing event:", err)
+	}
+
+	resp := postGzip(t, body.Bytes())
+	if resp.StatusCode >= 300 {
+		t.Fatalf("Expected the event to be accepted, got status code %d", resp.StatusCode)
+	}
+	if !strings.Contains(out.String(), `"label": "compressed"`) {
+		t.Errorf("Expected the decoded data to be displayed, got:\n%s", out)
+	}
+}
+
+func TestRun_MalformedGzipBody(t *testing.T) {
+	captureLog(t)
+	startRun(t, testConfig(t))
+
+	if resp := postGzip(t, []byte("not gzip")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestRun_GzipBomb(t *testing.T) {
+	captureLog(t)
+	cfg := testConfig(t)
+	cfg.MaxDecompressedBytes = 1 << 20
+
+	// 64MiB of zeros compress to about 64KiB. They are compressed before
+	// starting the receiver, which only runs for a while.
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zeros := make([]byte, 1<<20)
+	for i := 0; i < 64; i++ {
+		zw.Write(zeros)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal("Error compressing body:", err)
+	}
+	startRun(t, cfg)
+
+	if resp := postGzip(t, body.Bytes()); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+}
+
+// postGzip posts the given gzip-encoded structured event to the receiver.
+func postGzip(t *testing.T, body []byte) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ceClientURL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal("Error creating request:", err)
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error sending request:", err)
+	}
+	resp.Body.Close()
+	return resp
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// Name of the extension holding the SHA-256 of the data of events, as
+// computed by their sender.
+const dataHashExtension = "datasha256"
+
+// dataSHA256 returns the hex-encoded SHA-256 of the encoded data of the given
+// event.
+func dataSHA256(event cloudevents.Event) string {
+	sum := sha256.Sum256(event.DataEncoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// dataHashKey is the context key of the log field of the hash of the data of
+// the handled event.
+type dataHashKey struct{}
+
+// hashData returns an eventHandler which computes the SHA-256 of the data of
+// each event, to be logged with its display by next. When verify is set, a
+// warning is logged for events whose datasha256 extension doesn't match it.
+func hashData(verify bool, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		sum := dataSHA256(event)
+		if v, ok := event.Extensions()[dataHashExtension]; verify && ok && !strings.EqualFold(fmt.Sprint(v), sum) {
+			zap.L().Warn("Data hash mismatch",
+				zap.String("id", event.ID()),
+				zap.Any("expected", v),
+				zap.String("actual", sum))
+		}
+		ctx = context.WithValue(ctx, dataHashKey{}, zap.String(dataHashExtension, sum))
+		return next(ctx, event)
+	}
+}
+
+// dataHashFields returns the log field of the hash of the data of the event
+// handled with ctx, if any.
+func dataHashFields(ctx context.Context) []zap.Field {
+	field, ok := ctx.Value(dataHashKey{}).(zap.Field)
+	if !ok {
+		return nil
+	}
+	return []zap.Field{field}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// SHA-256 of "hello".
+const helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestDataSHA256(t *testing.T) {
+	event := newTestEvent(t)
+	if err := event.SetData("text/plain", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if got := dataSHA256(event); got != helloSHA256 {
+		t.Errorf("Expected SHA-256 %s, got %s", helloSHA256, got)
+	}
+}
+
+func TestHashData(t *testing.T) {
+	testCases := map[string]struct {
+		verify   bool
+		hash     string
+		mismatch bool
+	}{
+		"no extension": {
+			verify: true,
+		},
+		"matching extension": {
+			verify: true,
+			hash:   strings.ToUpper(helloSHA256),
+		},
+		"mismatching extension": {
+			verify:   true,
+			hash:     strings.Repeat("0", 64),
+			mismatch: true,
+		},
+		"mismatching extension not verified": {
+			hash: strings.Repeat("0", 64),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			event := newTestEvent(t)
+			if err := event.SetData("text/plain", "hello"); err != nil {
+				t.Fatal(err)
+			}
+			if tc.hash != "" {
+				event.SetExtension("datasha256", tc.hash)
+			}
+			out := captureLog(t)
+			if _, res := hashData(tc.verify, display(zap.L(), compactRenderer{}))(context.Background(), event); !cloudevents.IsACK(res) {
+				t.Fatal("Expected event to be acknowledged, got:", res)
+			}
+
+			if want := `"datasha256": "` + helloSHA256 + `"`; !strings.Contains(out.String(), want) {
+				t.Errorf("Expected %s to be logged, got:\n%s", want, out)
+			}
+			if got := strings.Contains(out.String(), "Data hash mismatch"); got != tc.mismatch {
+				t.Errorf("Expected mismatch warning to be logged: %v, got:\n%s", tc.mismatch, out)
+			}
+		})
+	}
+}
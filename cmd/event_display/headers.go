@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// parseResponseHeaders parses a comma-separated list of name:value pairs of
+// headers set on responses.
+func parseResponseHeaders(s string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, pair := range splitList(s) {
+		name, value, ok := strings.Cut(pair, ":")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			return nil, fmt.Errorf("invalid response header %q, expected name:value", pair)
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// responseHeadersMiddleware returns a cehttp.Middleware which sets the given
+// headers on every response, before handling the request.
+func responseHeadersMiddleware(headers http.Header) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(headers) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			for name, values := range headers {
+				w.Header()[name] = append([]string(nil), values...)
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseResponseHeaders(t *testing.T) {
+	got, err := parseResponseHeaders("X-Processed-By:display, x-retry-after: 0,X-Empty:")
+	if err != nil {
+		t.Fatal("Error parsing response headers:", err)
+	}
+	want := http.Header{
+		"X-Processed-By": {"display"},
+		"X-Retry-After":  {"0"},
+		"X-Empty":        {""},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("Unexpected headers (-want, +got):", diff)
+	}
+
+	for _, s := range []string{"X-Processed-By", ":display"} {
+		if _, err := parseResponseHeaders(s); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestRun_ResponseHeaders(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ResponseHeaders = "X-Processed-By:display"
+	startRun(t, cfg)
+
+	body := `{"specversion":"1.0","type":"dev.knative.eventing.samples.heartbeat","source":"https://knative.dev/eventing/cmd/heartbeats","id":"1"}`
+	resp, err := http.Post(ceClientURL, "application/cloudevents+json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal("Error posting event:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		t.Fatal("Unexpected status code:", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Processed-By"); got != "display" {
+		t.Errorf("Got X-Processed-By header %q, want display", got)
+	}
+}
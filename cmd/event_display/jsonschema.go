@@ -0,0 +1,567 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// No JSON Schema library is a dependency of this module, so jsonSchema
+// implements a deliberately small subset of JSON Schema draft-07: the
+// validation keywords most used to describe event data, and local references.
+// Schemas using anything else are rejected when loaded, rather than partially
+// applied.
+
+// jsonSchemaKeywords are the supported keywords. Annotations and
+// containers of subschemas are accepted without affecting validation.
+var jsonSchemaKeywords = map[string]bool{
+	// Annotations.
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "format": true, "readOnly": true, "writeOnly": true,
+	"definitions": true, "$defs": true,
+	// Validations.
+	"$ref": true, "type": true, "enum": true, "const": true,
+	"properties": true, "required": true, "additionalProperties": true, "minProperties": true, "maxProperties": true,
+	"items": true, "minItems": true, "maxItems": true, "uniqueItems": true,
+	"minLength": true, "maxLength": true, "pattern": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true, "multipleOf": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true,
+}
+
+// Maximum number of nested references followed while validating a value, so
+// that schemas referencing themselves without nesting can't recurse forever.
+const maxJSONSchemaRefDepth = 32
+
+// jsonSchema validates JSON documents against a schema. It is safe for
+// concurrent use.
+type jsonSchema struct {
+	root interface{}
+	// Compiled patterns of the schema, by expression.
+	patterns map[string]*regexp.Regexp
+	// References whose target was checked while loading the schema.
+	checkedRefs map[string]bool
+}
+
+// loadJSONSchema returns the JSON schema in the file at the given path.
+func loadJSONSchema(path string) (*jsonSchema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSONSchema(b)
+}
+
+// parseJSONSchema parses the given JSON schema, and checks that it only uses
+// supported keywords and local references.
+func parseJSONSchema(b []byte) (*jsonSchema, error) {
+	root, err := decodeJSONValue(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	s := &jsonSchema{root: root, patterns: make(map[string]*regexp.Regexp), checkedRefs: make(map[string]bool)}
+	if err := s.check(root, "#"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// decodeJSONValue decodes the given JSON document, with numbers kept as
+// json.Number.
+func decodeJSONValue(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return v, nil
+}
+
+// check returns an error if the subschema at the given location isn't valid
+// or unsupported.
+func (s *jsonSchema) check(schema interface{}, at string) error {
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+	obj, ok := schema.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("schema at %s must be an object or a boolean", at)
+	}
+	for keyword, value := range obj {
+		if !jsonSchemaKeywords[keyword] {
+			return fmt.Errorf("unsupported keyword %q at %s", keyword, at)
+		}
+		var err error
+		switch keyword {
+		case "properties", "definitions", "$defs":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s at %s must be an object", keyword, at)
+			}
+			for name, sub := range props {
+				if err := s.check(sub, at+"/"+keyword+"/"+name); err != nil {
+					return err
+				}
+			}
+		case "additionalProperties", "not":
+			err = s.check(value, at+"/"+keyword)
+		case "items":
+			if tuple, ok := value.([]interface{}); ok {
+				err = s.checkAll(tuple, at+"/"+keyword)
+			} else {
+				err = s.check(value, at+"/"+keyword)
+			}
+		case "allOf", "anyOf", "oneOf":
+			subs, ok := value.([]interface{})
+			if !ok || len(subs) == 0 {
+				return fmt.Errorf("%s at %s must be a non-empty array", keyword, at)
+			}
+			err = s.checkAll(subs, at+"/"+keyword)
+		case "$ref":
+			ref, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("$ref at %s must be a string", at)
+			}
+			target, err := s.resolve(ref)
+			if err != nil {
+				return fmt.Errorf("$ref at %s: %w", at, err)
+			}
+			// Targets may not be schemas, such as #/required, and are only
+			// checked once, as they can reference themselves.
+			if !s.checkedRefs[ref] {
+				s.checkedRefs[ref] = true
+				if err := s.check(target, ref); err != nil {
+					return fmt.Errorf("$ref at %s: %w", at, err)
+				}
+			}
+		case "type":
+			err = checkJSONSchemaTypes(value, at)
+		case "enum":
+			if _, ok := value.([]interface{}); !ok {
+				return fmt.Errorf("enum at %s must be an array", at)
+			}
+		case "required":
+			names, ok := value.([]interface{})
+			for _, name := range names {
+				if _, isString := name.(string); !isString {
+					ok = false
+				}
+			}
+			if !ok {
+				return fmt.Errorf("required at %s must be an array of strings", at)
+			}
+		case "pattern":
+			expr, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("pattern at %s must be a string", at)
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("pattern at %s: %w", at, err)
+			}
+			s.patterns[expr] = re
+		case "minProperties", "maxProperties", "minItems", "maxItems", "minLength", "maxLength",
+			"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf":
+			if _, ok := jsonNumber(value); !ok {
+				return fmt.Errorf("%s at %s must be a number", keyword, at)
+			}
+		case "uniqueItems":
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("uniqueItems at %s must be a boolean", at)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) checkAll(schemas []interface{}, at string) error {
+	for i, sub := range schemas {
+		if err := s.check(sub, at+"/"+strconv.Itoa(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonSchemaTypes are the types of the type keyword.
+var jsonSchemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true, "number": true, "integer": true, "string": true,
+}
+
+func checkJSONSchemaTypes(value interface{}, at string) error {
+	types, ok := value.([]interface{})
+	if !ok {
+		types = []interface{}{value}
+	}
+	for _, t := range types {
+		if name, ok := t.(string); !ok || !jsonSchemaTypes[name] {
+			return fmt.Errorf("unknown type %v at %s", t, at)
+		}
+	}
+	return nil
+}
+
+// resolve returns the subschema at the given local reference, a JSON pointer
+// in the schema such as #/definitions/item.
+func (s *jsonSchema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %q, only local references are", ref)
+	}
+	v := s.root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return v, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("unsupported reference %q, only JSON pointers are", ref)
+	}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[token]; !ok {
+				return nil, fmt.Errorf("unresolved reference %q", ref)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("unresolved reference %q", ref)
+			}
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("unresolved reference %q", ref)
+		}
+	}
+	return v, nil
+}
+
+// Validate returns the violations of the schema by the given JSON document,
+// sorted, each prefixed by the JSON pointer of the invalid value.
+func (s *jsonSchema) Validate(data []byte) []string {
+	v, err := decodeJSONValue(data)
+	if err != nil {
+		return []string{"invalid JSON: " + err.Error()}
+	}
+	var violations []string
+	s.validate(s.root, v, "", 0, &violations)
+	sort.Strings(violations)
+	return violations
+}
+
+func (s *jsonSchema) validate(schema, v interface{}, at string, depth int, violations *[]string) {
+	fail := func(format string, args ...interface{}) {
+		location := at
+		if location == "" {
+			location = "/"
+		}
+		*violations = append(*violations, location+": "+fmt.Sprintf(format, args...))
+	}
+
+	if b, ok := schema.(bool); ok {
+		if !b {
+			fail("no value is allowed")
+		}
+		return
+	}
+	obj, ok := schema.(map[string]interface{})
+	if !ok {
+		// Schemas are checked when loaded.
+		fail("invalid schema")
+		return
+	}
+	if ref, ok := obj["$ref"].(string); ok {
+		// As of draft-07, the keywords next to $ref are ignored.
+		if depth >= maxJSONSchemaRefDepth {
+			fail("too many nested references")
+			return
+		}
+		target, _ := s.resolve(ref)
+		s.validate(target, v, at, depth+1, violations)
+		return
+	}
+
+	if types, ok := obj["type"]; ok && !hasJSONSchemaType(types, v) {
+		fail("expected %s, got %s", formatJSONSchemaTypes(types), jsonTypeOf(v))
+		// The other keywords don't apply to values of another type.
+		return
+	}
+	if enum, ok := obj["enum"].([]interface{}); ok && !jsonContains(enum, v) {
+		fail("value isn't one of the enumerated values")
+	}
+	if c, ok := obj["const"]; ok && !jsonEqual(c, v) {
+		fail("value isn't the constant value")
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		props, _ := obj["properties"].(map[string]interface{})
+		required, _ := obj["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := v[name.(string)]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		for name, value := range v {
+			sub, ok := props[name]
+			if !ok {
+				if sub, ok = obj["additionalProperties"]; !ok {
+					continue
+				}
+			}
+			s.validate(sub, value, at+"/"+strings.NewReplacer("~", "~0", "/", "~1").Replace(name), depth, violations)
+		}
+		if n, ok := jsonNumber(obj["minProperties"]); ok && float64(len(v)) < n {
+			fail("expected at least %v properties, got %d", n, len(v))
+		}
+		if n, ok := jsonNumber(obj["maxProperties"]); ok && float64(len(v)) > n {
+			fail("expected at most %v properties, got %d", n, len(v))
+		}
+	case []interface{}:
+		for i, item := range v {
+			sub, ok := obj["items"]
+			if tuple, isTuple := sub.([]interface{}); isTuple {
+				// Items beyond the tuple are allowed, additionalItems isn't
+				// supported.
+				if ok = i < len(tuple); ok {
+					sub = tuple[i]
+				}
+			}
+			if ok {
+				s.validate(sub, item, at+"/"+strconv.Itoa(i), depth, violations)
+			}
+		}
+		if n, ok := jsonNumber(obj["minItems"]); ok && float64(len(v)) < n {
+			fail("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := jsonNumber(obj["maxItems"]); ok && float64(len(v)) > n {
+			fail("expected at most %v items, got %d", n, len(v))
+		}
+		if unique, _ := obj["uniqueItems"].(bool); unique {
+			for i := range v {
+				if jsonContains(v[:i], v[i]) {
+					fail("items aren't unique")
+					break
+				}
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := jsonNumber(obj["minLength"]); ok && length < n {
+			fail("expected at least %v characters, got %v", n, length)
+		}
+		if n, ok := jsonNumber(obj["maxLength"]); ok && length > n {
+			fail("expected at most %v characters, got %v", n, length)
+		}
+		if expr, ok := obj["pattern"].(string); ok && !s.patterns[expr].MatchString(v) {
+			fail("value doesn't match pattern %q", expr)
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n, ok := jsonNumber(obj["minimum"]); ok && f < n {
+			fail("expected at least %v, got %v", n, v)
+		}
+		if n, ok := jsonNumber(obj["maximum"]); ok && f > n {
+			fail("expected at most %v, got %v", n, v)
+		}
+		if n, ok := jsonNumber(obj["exclusiveMinimum"]); ok && f <= n {
+			fail("expected more than %v, got %v", n, v)
+		}
+		if n, ok := jsonNumber(obj["exclusiveMaximum"]); ok && f >= n {
+			fail("expected less than %v, got %v", n, v)
+		}
+		if n, ok := jsonNumber(obj["multipleOf"]); ok && n > 0 {
+			if q := f / n; math.Abs(q-math.Round(q)) > 1e-9 {
+				fail("expected a multiple of %v, got %v", n, v)
+			}
+		}
+	}
+
+	if all, ok := obj["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.validate(sub, v, at, depth, violations)
+		}
+	}
+	if anyOf, ok := obj["anyOf"].([]interface{}); ok && s.countValid(anyOf, v, at, depth) == 0 {
+		fail("value matches none of the anyOf schemas")
+	}
+	if oneOf, ok := obj["oneOf"].([]interface{}); ok {
+		if n := s.countValid(oneOf, v, at, depth); n != 1 {
+			fail("value matches %d of the oneOf schemas, expected 1", n)
+		}
+	}
+	if not, ok := obj["not"]; ok && s.countValid([]interface{}{not}, v, at, depth) == 1 {
+		fail("value matches the not schema")
+	}
+}
+
+// countValid returns the number of the given schemas which v is valid against.
+func (s *jsonSchema) countValid(schemas []interface{}, v interface{}, at string, depth int) int {
+	n := 0
+	for _, sub := range schemas {
+		var violations []string
+		if s.validate(sub, v, at, depth, &violations); len(violations) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// jsonNumber returns the value of the given JSON number, and whether v is one.
+func jsonNumber(v interface{}) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// jsonTypeOf returns the JSON Schema type of the given decoded value, integer
+// for numbers without a fractional part.
+func jsonTypeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+func hasJSONSchemaType(types, v interface{}) bool {
+	list, ok := types.([]interface{})
+	if !ok {
+		list = []interface{}{types}
+	}
+	actual := jsonTypeOf(v)
+	for _, t := range list {
+		if t == actual || t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func formatJSONSchemaTypes(types interface{}) string {
+	list, ok := types.([]interface{})
+	if !ok {
+		return fmt.Sprint(types)
+	}
+	names := make([]string, 0, len(list))
+	for _, t := range list {
+		names = append(names, fmt.Sprint(t))
+	}
+	return strings.Join(names, " or ")
+}
+
+// jsonEqual returns whether the given decoded values are equal, numbers being
+// compared by value.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, errA := a.Float64()
+		fb, errB := b.Float64()
+		return errA == nil && errB == nil && fa == fb
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, va := range a {
+			if vb, ok := b[k]; !ok || !jsonEqual(va, vb) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func jsonContains(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if jsonEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDataSchema returns an eventHandler which validates the JSON data of
+// each event against the given schema before passing it to next. Violations
+// are logged and counted, but don't fail the receive. Events without data or
+// with data which isn't JSON aren't validated.
+func validateDataSchema(s *jsonSchema, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		mediaType, _, _ := mime.ParseMediaType(event.DataContentType())
+		if data := event.Data(); len(data) > 0 && isJSONMediaType(mediaType) {
+			if violations := s.Validate(data); len(violations) > 0 {
+				schemaViolations.WithLabelValues().Inc()
+				zap.L().Error("Event data violates the JSON schema", zap.String("id", event.ID()), zap.Strings("violations", violations))
+			}
+		}
+		return next(ctx, event)
+	}
+}
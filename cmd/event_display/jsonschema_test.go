@@ -0,0 +1,201 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+const orderSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["id", "items"],
+  "properties": {
+    "id": {"type": "integer", "minimum": 1},
+    "status": {"enum": ["open", "paid"]},
+    "email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+    "items": {"type": "array", "minItems": 1, "items": {"$ref": "#/definitions/item"}}
+  },
+  "additionalProperties": false,
+  "definitions": {
+    "item": {
+      "type": "object",
+      "required": ["sku"],
+      "properties": {
+        "sku": {"type": "string", "minLength": 3},
+        "quantity": {"type": "number", "exclusiveMinimum": 0, "multipleOf": 0.5}
+      }
+    }
+  }
+}`
+
+func TestJSONSchema_Validate(t *testing.T) {
+	s, err := parseJSONSchema([]byte(orderSchema))
+	if err != nil {
+		t.Fatal("Error parsing schema:", err)
+	}
+
+	testCases := map[string]struct {
+		data string
+		want []string
+	}{
+		"conforming": {
+			data: `{"id": 12, "status": "paid", "email": "a@b.c", "items": [{"sku": "book", "quantity": 1.5}]}`,
+		},
+		"non-conforming": {
+			data: `{"id": 1.5, "status": "lost", "email": "nobody", "items": [{"sku": "pe", "quantity": 0}, {}], "coupon": "x"}`,
+			want: []string{
+				`/coupon: no value is allowed`,
+				`/email: value doesn't match pattern "^[^@]+@[^@]+$"`,
+				`/id: expected integer, got number`,
+				`/items/0/quantity: expected more than 0, got 0`,
+				`/items/0/sku: expected at least 3 characters, got 2`,
+				`/items/1: missing required property "sku"`,
+				`/status: value isn't one of the enumerated values`,
+			},
+		},
+		"wrong type": {
+			data: `["order"]`,
+			want: []string{`/: expected object, got array`},
+		},
+		"missing properties": {
+			data: `{"items": []}`,
+			want: []string{`/: missing required property "id"`, `/items: expected at least 1 items, got 0`},
+		},
+		"invalid JSON": {
+			data: `{"id":`,
+			want: []string{"invalid JSON: unexpected EOF"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, s.Validate([]byte(tc.data))); diff != "" {
+				t.Error("Unexpected violations (-want, +got):", diff)
+			}
+		})
+	}
+}
+
+func TestJSONSchema_Combinations(t *testing.T) {
+	s, err := parseJSONSchema([]byte(`{
+		"oneOf": [{"type": "string"}, {"type": "integer"}],
+		"not": {"const": 0},
+		"anyOf": [{"type": "integer", "maximum": 10}, {"type": "string", "maxLength": 3}]
+	}`))
+	if err != nil {
+		t.Fatal("Error parsing schema:", err)
+	}
+	for data, valid := range map[string]bool{
+		`"abc"`:  true,
+		`7`:      true,
+		`0`:      false,
+		`11`:     false,
+		`"abcd"`: false,
+		`true`:   false,
+	} {
+		if got := s.Validate([]byte(data)); (len(got) == 0) != valid {
+			t.Errorf("Expected %s to be valid: %v, got violations %v", data, valid, got)
+		}
+	}
+}
+
+func TestJSONSchema_RecursiveReference(t *testing.T) {
+	s, err := parseJSONSchema([]byte(`{"type": "object", "properties": {"child": {"$ref": "#"}}}`))
+	if err != nil {
+		t.Fatal("Error parsing schema:", err)
+	}
+	if got := s.Validate([]byte(`{"child": {"child": {}}}`)); len(got) != 0 {
+		t.Error("Expected nested values to be valid, got violations", got)
+	}
+	if got := s.Validate([]byte(`{"child": {"child": 1}}`)); len(got) != 1 || !strings.HasPrefix(got[0], "/child/child:") {
+		t.Error("Expected the nested value to violate the schema, got", got)
+	}
+}
+
+func TestParseJSONSchema_Invalid(t *testing.T) {
+	for name, schema := range map[string]string{
+		"invalid JSON":                 `{"type":`,
+		"unsupported keyword":          `{"patternProperties": {"^x": {}}}`,
+		"unsupported reference":        `{"$ref": "https://example.com/schema.json"}`,
+		"unresolved reference":         `{"$ref": "#/definitions/missing"}`,
+		"unknown type":                 `{"properties": {"id": {"type": "int"}}}`,
+		"invalid pattern":              `{"pattern": "["}`,
+		"non-schema":                   `{"items": 1}`,
+		"non-schema reference":         `{"required": ["a"], "properties": {"a": {"$ref": "#/required"}}}`,
+		"unsupported reference target": `{"properties": {"a": {"$ref": "#/enum/0"}}, "enum": [{"patternProperties": {}}]}`,
+	} {
+		if _, err := parseJSONSchema([]byte(schema)); err == nil {
+			t.Errorf("Expected an error for the %s schema", name)
+		}
+	}
+}
+
+func TestValidateDataSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "order.json")
+	if err := os.WriteFile(path, []byte(orderSchema), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadJSONSchema(path)
+	if err != nil {
+		t.Fatal("Error loading schema:", err)
+	}
+
+	conforming := newTestEvent(t)
+	if err := conforming.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"id": 1, "items": []map[string]string{{"sku": "book"}}}); err != nil {
+		t.Fatal(err)
+	}
+	nonConforming := newTestEvent(t)
+	text := newTestEvent(t)
+	if err := text.SetData("text/plain", "not an order"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		event      cloudevents.Event
+		violations float64
+	}{
+		"conforming":     {event: conforming},
+		"non-conforming": {event: nonConforming, violations: 1},
+		"non-JSON":       {event: text},
+	} {
+		t.Run(name, func(t *testing.T) {
+			out := captureLog(t)
+			before := counterValue(t, "schema_violations_total", nil)
+			if _, res := validateDataSchema(s, display(zap.L(), compactRenderer{}))(context.Background(), tc.event); !cloudevents.IsACK(res) {
+				t.Fatal("Expected event to be acknowledged, got:", res)
+			}
+
+			if got := counterValue(t, "schema_violations_total", nil) - before; got != tc.violations {
+				t.Errorf("Expected %v schema violations to be counted, got %v", tc.violations, got)
+			}
+			if logged := strings.Contains(out.String(), "violates the JSON schema"); logged != (tc.violations > 0) {
+				t.Errorf("Expected violations to be logged: %v, got:\n%s", tc.violations > 0, out)
+			}
+			if !strings.Contains(out.String(), tc.event.ID()) {
+				t.Errorf("Expected the event to be displayed, got:\n%s", out)
+			}
+		})
+	}
+}
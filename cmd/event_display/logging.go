@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// newLogger returns a logger which writes entries at or above the given level
+// (debug, info, warn or error) to w.
+func newLogger(w io.Writer, level string) (*zap.Logger, error) {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	// Disabling timestamp
+	encoderConfig.TimeKey = ""
+	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), zapcore.Lock(zapcore.AddSync(w)), lvl)
+	return zap.New(core), nil
+}
+
+// newMessageLogger returns a logger which writes only the message of entries
+// at or above the given level to w, one per line. Levels and fields are left
+// out, so that messages can be parsed by other programs.
+func newMessageLogger(w io.Writer, level string) (*zap.Logger, error) {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	encoderConfig := zapcore.EncoderConfig{
+		MessageKey: "msg",
+		LineEnding: zapcore.DefaultLineEnding,
+	}
+	encoder := messageEncoder{zapcore.NewConsoleEncoder(encoderConfig)}
+	core := zapcore.NewCore(encoder, zapcore.Lock(zapcore.AddSync(w)), lvl)
+	return zap.New(core), nil
+}
+
+// messageEncoder is a zapcore.Encoder which drops the fields of entries.
+type messageEncoder struct {
+	zapcore.Encoder
+}
+
+func (e messageEncoder) Clone() zapcore.Encoder {
+	return messageEncoder{e.Encoder.Clone()}
+}
+
+func (e messageEncoder) EncodeEntry(entry zapcore.Entry, _ []zapcore.Field) (*buffer.Buffer, error) {
+	return e.Encoder.EncodeEntry(entry, nil)
+}
+
+// openLogOutputs returns the writers of operational logs and of event output,
+// to the standard streams named logStream and outputStream respectively. Both
+// are also written to the log file at path, which is skipped when path is
+// empty or "none". The returned function closes the log file.
+func openLogOutputs(path, logStream, outputStream string) (logOut, eventOut io.Writer, closeOut func() error, err error) {
+	if logOut, err = standardStream(logStream); err != nil {
+		return nil, nil, nil, err
+	}
+	if eventOut, err = standardStream(outputStream); err != nil {
+		return nil, nil, nil, err
+	}
+	if path == "" || path == "none" {
+		return logOut, eventOut, func() error { return nil }, nil
+	}
+	logFile, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// Failing to write to the file, e.g. once the disk is full, must neither
+	// fail nor block writing to the standard streams.
+	file := &tolerantWriter{w: logFile, name: path, errOut: logOut}
+	return io.MultiWriter(logOut, file), io.MultiWriter(eventOut, file), logFile.Close, nil
+}
+
+// syslogNetwork splits the given syslog address, [udp://|tcp://]host:port,
+// into its network, udp by default, and its host and port.
+func syslogNetwork(addr string) (network, hostPort string) {
+	if network, hostPort, ok := strings.Cut(addr, "://"); ok {
+		return network, hostPort
+	}
+	return "udp", addr
+}
+
+// withSyslog returns the given writers of operational logs and of event
+// output, also writing to the syslog server at addr, event output only when
+// events is set. Failing to connect to the server, or later to write to it,
+// is reported to logOut, which is written to nonetheless. The returned
+// function closes the connection.
+func withSyslog(logOut, eventOut io.Writer, addr string, events bool) (io.Writer, io.Writer, func() error) {
+	w, err := openSyslog(addr)
+	if err != nil {
+		fmt.Fprintf(logOut, "Failed to connect to syslog at %s, not writing to it: %v\n", addr, err)
+		return logOut, eventOut, func() error { return nil }
+	}
+	sys := &tolerantWriter{w: w, name: "syslog at " + addr, errOut: logOut}
+	if events {
+		eventOut = io.MultiWriter(eventOut, sys)
+	}
+	return io.MultiWriter(logOut, sys), eventOut, w.Close
+}
+
+// tolerantWriter is an io.Writer which stops writing to w once a write fails,
+// reporting the failure once to errOut. Writes never fail. It is safe for
+// concurrent use.
+type tolerantWriter struct {
+	w      io.Writer
+	name   string
+	errOut io.Writer
+
+	mu     sync.Mutex
+	failed bool
+}
+
+func (t *tolerantWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failed {
+		return len(p), nil
+	}
+	if _, err := t.w.Write(p); err != nil {
+		t.failed = true
+		// Not logged, loggers might be writing to this writer.
+		fmt.Fprintf(t.errOut, "Failed to write to %s, no longer writing to it: %v\n", t.name, err)
+	}
+	return len(p), nil
+}
+
+// standardStream returns the standard stream of the given name, stdout or
+// stderr.
+func standardStream(name string) (io.Writer, error) {
+	switch name {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		return nil, fmt.Errorf("unknown stream %q, expected stdout or stderr", name)
+	}
+}
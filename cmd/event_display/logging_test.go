@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewLogger_LevelGate(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger, err := newLogger(buf, "info")
+	if err != nil {
+		t.Fatal("Error creating logger:", err)
+	}
+
+	logger.Debug("debug line")
+	logger.Info("info line")
+
+	if out := buf.String(); strings.Contains(out, "debug line") {
+		t.Errorf("Expected debug line to be suppressed, got:\n%s", out)
+	}
+	if out := buf.String(); !strings.Contains(out, "info line") {
+		t.Errorf("Expected info line to be written, got:\n%s", out)
+	}
+}
+
+func TestNewLogger_InvalidLevel(t *testing.T) {
+	if _, err := newLogger(new(bytes.Buffer), "verbose"); err == nil {
+		t.Error("Expected an error for an invalid level")
+	}
+}
+
+func TestOpenLogOutputs(t *testing.T) {
+	for _, path := range []string{"", "none"} {
+		logOut, eventOut, closeOut, err := openLogOutputs(path, "stdout", "stderr")
+		if err != nil {
+			t.Errorf("Unexpected error for log file path %q: %v", path, err)
+			continue
+		}
+		if logOut != os.Stdout || eventOut != os.Stderr {
+			t.Errorf("Expected only the standard streams to be written for log file path %q", path)
+		}
+		if err := closeOut(); err != nil {
+			t.Errorf("Unexpected error closing output for log file path %q: %v", path, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	logOut, eventOut, closeOut, err := openLogOutputs(path, "stdout", "stdout")
+	if err != nil {
+		t.Fatal("Unexpected error opening log file:", err)
+	}
+	if _, err := io.WriteString(logOut, "hello\n"); err != nil {
+		t.Fatal("Error writing log output:", err)
+	}
+	if _, err := io.WriteString(eventOut, "event\n"); err != nil {
+		t.Fatal("Error writing event output:", err)
+	}
+	if err := closeOut(); err != nil {
+		t.Fatal("Error closing log file:", err)
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != "hello\nevent\n" {
+		t.Errorf("Expected log file to contain both outputs, got %q (err: %v)", b, err)
+	}
+
+	if _, _, _, err := openLogOutputs("", "stdout", "stdlog"); err == nil {
+		t.Error("Expected an error for an unknown stream")
+	}
+}
+
+func TestTolerantWriter(t *testing.T) {
+	var stdout, errOut bytes.Buffer
+	file := &tolerantWriter{w: &failingWriter{limit: 10}, name: "app.log", errOut: &errOut}
+	w := io.MultiWriter(&stdout, file)
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := io.WriteString(w, line); err != nil {
+			t.Fatal("Expected writes to keep succeeding, got:", err)
+		}
+	}
+
+	if got, want := stdout.String(), "first\nsecond\nthird\n"; got != want {
+		t.Errorf("Expected all lines to be written to stdout, got %q", got)
+	}
+	if got := strings.Count(errOut.String(), "Failed to write to app.log"); got != 1 {
+		t.Errorf("Expected the failure to be reported once, got:\n%s", errOut.String())
+	}
+}
+
+// failingWriter is an io.Writer which fails once more than limit bytes are
+// written.
+type failingWriter struct {
+	limit   int
+	written int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.limit {
+		return 0, errors.New("no space left on device")
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestRun_OutputRouting(t *testing.T) {
+	logOut := captureLog(t)
+	eventOut := new(bytes.Buffer)
+	cfg := testConfig(t)
+	cfg.RequestLoggingEnabled = true
+	cfg.EventOutput = eventOut
+
+	stop := startRun(t, cfg)
+	sendEvent(t, newTestEvent(t))
+	stop()
+
+	if out := eventOut.String(); !strings.Contains(out, "☁️  cloudevents.Event") || strings.Contains(out, "Request logging enabled") {
+		t.Errorf("Expected only events in the event output, got:\n%s", out)
+	}
+	if out := logOut.String(); strings.Contains(out, "☁️  cloudevents.Event") || !strings.Contains(out, "Request logging enabled") {
+		t.Errorf("Expected only operational logs in the log output, got:\n%s", out)
+	}
+}
+
+func TestDisplay_LogsEventFields(t *testing.T) {
+	out := captureLog(t)
+	event := newTestEvent(t)
+
+	display(zap.L(), compactRenderer{})(context.Background(), event)
+
+	for _, want := range []string{
+		"INFO",
+		`"type": "` + event.Type() + `"`,
+		`"source": "` + event.Source() + `"`,
+		`"id": "` + event.ID() + `"`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
@@ -19,21 +19,30 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/cloudevents/sdk-go/observability/opencensus/v2/client"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
 
+	"go.opencensus.io/trace"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"knative.dev/pkg/tracing"
-	"knative.dev/pkg/tracing/config"
 )
 
 /*
@@ -47,7 +56,7 @@ Context Attributes,
   source: https://knative.dev/eventing-contrib/cmd/heartbeats/#event-test/mypod
   id: 2b72d7bf-c38f-4a98-a433-608fbcdd2596
   time: 2019-10-18T15:23:20.809775386Z
-  contenttype: application/json
+  datacontenttype: application/json
 Extensions,
   beats: true
   heart: yes
@@ -57,98 +66,791 @@ Data,
     "id": 2,
     "label": ""
   }
+mode: binary
 */
 
-// display prints the given Event in a human-readable format.
-func display(event cloudevents.Event) {
-	jsonstr, _ := json.Marshal(event.Context.GetExtensions())
-	log.Printf("{\"data\": %s, \"type\": %s, \"extensions\": %s}",
-		event.DataEncoded,
-		event.Context.GetType(),
-		string(jsonstr),
-	)
+// eventHandler handles a received Event. The returned Event, if any, is sent
+// back to the sender as a reply.
+type eventHandler func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result)
+
+// display returns an eventHandler which prints each Event to the given logger
+// using the given renderer. Displaying each Event is traced as a child span of
+// the incoming trace context.
+func display(logger *zap.Logger, r eventRenderer) eventHandler {
+	return displayOutputs([]eventOutput{{logger: logger, renderer: r}}, false)
 }
 
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
+// displayOutputs returns an eventHandler which prints each Event to all the
+// given outputs, as display does. Events failing to be rendered for an output
+// are rejected with a 500 when nackErrors is set, so that senders retry them,
+// and acknowledged otherwise.
+func displayOutputs(outputs []eventOutput, nackErrors bool) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		_, span := trace.StartSpan(ctx, "display")
+		defer span.End()
+		span.AddAttributes(
+			trace.StringAttribute("ce.type", event.Type()),
+			trace.StringAttribute("ce.source", event.Source()),
+			trace.StringAttribute("ce.id", event.ID()),
+		)
+
+		eventsReceived.WithLabelValues(event.Type(), event.Source()).Inc()
+		countPartitionKey(event)
+		fields := []zap.Field{
+			zap.String("type", event.Type()),
+			zap.String("source", event.Source()),
+			zap.String("id", event.ID()),
+		}
+		if schema := event.DataSchema(); schema != "" {
+			fields = append(fields, zap.String("dataschema", schema))
+		}
+		if key, ok := partitionKey(event); ok {
+			fields = append(fields, zap.String("partitionkey", key))
+		}
+		mode := bindingMode(ctx)
+		if mode != "" {
+			fields = append(fields, zap.String("mode", mode))
+		}
+		fields = append(fields, requestIDFields(ctx)...)
+		fields = append(fields, extractedFields(ctx)...)
+		fields = append(fields, dataHashFields(ctx)...)
+		var renderErr error
+		for _, o := range outputs {
+			out, err := o.renderer.Render(event)
+			if err != nil {
+				displayErrors.WithLabelValues().Inc()
+				zap.L().Error("Failed to render event", zap.String("id", event.ID()), zap.Error(err))
+				renderErr = err
+				continue
+			}
+			if out != "" && o.modeLine && mode != "" {
+				out += "\nmode: " + mode
+			}
+			if out != "" {
+				o.logger.Info(out, fields...)
+			}
+		}
+		if nackErrors && renderErr != nil {
+			return nil, cehttp.NewResult(http.StatusInternalServerError, "failed to render event: %v", renderErr)
+		}
+		return nil, nil
 	}
-	return fallback
+}
+
+// bindingMode returns the content mode, binary or structured, of the HTTP
+// request which carried the event handled with ctx. It returns an empty string
+// when the request isn't known.
+func bindingMode(ctx context.Context) string {
+	req := cehttp.RequestDataFromContext(ctx)
+	if req == nil {
+		return ""
+	}
+	return cehttp.NewMessage(req.Header, nil).ReadEncoding().String()
+}
+
+// splitList splits a comma-separated list, ignoring blank items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func main() {
-	logFile, err := os.OpenFile(getEnv("LOG_FILE_PATH", "/var/log/app.log"), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0666)
+	cfg, err := loadConfig()
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if cfg.DryRun {
+		if err := checkConfig(cfg); err != nil {
+			log.Fatal("Invalid configuration: ", err)
+		}
+		if err := printConfig(os.Stdout, cfg); err != nil {
+			log.Fatal("Failed to print configuration: ", err)
+		}
+		return
+	}
+
+	logOut, eventOut, closeOut, err := openLogOutputs(cfg.LogFilePath, cfg.LogStream, cfg.OutputStream)
 	if err != nil {
 		panic(err)
 	}
-	mw := io.MultiWriter(os.Stdout, logFile)
+	if cfg.SyslogAddr != "" {
+		var closeSyslog func() error
+		logOut, eventOut, closeSyslog = withSyslog(logOut, eventOut, cfg.SyslogAddr, cfg.SyslogEvents)
+		defer closeSyslog()
+	}
 
 	// Disabling timestamp
 	log.SetFlags(0)
 
-	log.SetOutput(mw)
-	defer logFile.Close()
+	log.SetOutput(logOut)
+	defer closeOut()
 
-	run(context.Background())
+	cfg.EventOutput = eventOut
+	run(context.Background(), cfg)
 }
 
-func run(ctx context.Context) {
+// run logs operational messages to the output of the standard logger and
+// displays events to the configured event output.
+func run(ctx context.Context, cfg Config) {
+	// Stop receiving on pod termination so in-flight events are drained and
+	// deferred cleanups get a chance to run.
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	requestLoggingEnabled, _ := strconv.ParseBool(os.Getenv("REQUEST_LOGGING_ENABLED"))
-	if requestLoggingEnabled {
-		log.Println("Request logging enabled, request logging is not recommended for production since it might log sensitive information")
+	// Quiet instances only log the errors on which they exit, so that their
+	// output is only made of events.
+	logLevel := cfg.LogLevel
+	if cfg.Quiet {
+		logLevel = "fatal"
 	}
-
-	c, err := client.NewClientHTTP(
-		[]cehttp.Option{
-			cehttp.WithMiddleware(healthzMiddleware),
-			cehttp.WithMiddleware(requestLoggingMiddleware(requestLoggingEnabled)),
-		}, nil,
-	)
+	logger, err := newLogger(log.Writer(), logLevel)
 	if err != nil {
-		log.Fatal("Failed to create client: ", err)
+		log.Fatal("Failed to create logger: ", err)
 	}
-	conf, err := config.JSONToTracingConfig(os.Getenv("K_CONFIG_TRACING"))
-	if err != nil {
-		log.Printf("Failed to read tracing config, using the no-op default: %v", err)
+	eventOut := cfg.EventOutput
+	if eventOut == nil {
+		eventOut = log.Writer()
+	}
+	newEventLogger := newLogger
+	if isMessageFormat(cfg.OutputFormat) {
+		newEventLogger = newMessageLogger
 	}
-	tracer, err := tracing.SetupPublishingWithStaticConfig(zap.L().Sugar(), "", conf)
+	eventLogger, err := newEventLogger(eventOut, cfg.LogLevel)
 	if err != nil {
-		log.Fatalf("Failed to initialize tracing: %v", err)
+		log.Fatal("Failed to create event logger: ", err)
+	}
+	defer eventLogger.Sync()
+	defer logger.Sync()
+	defer zap.ReplaceGlobals(logger)()
+	logConfig(logger, cfg)
+
+	tracingConfig := loadTracingConfig(logger, cfg.ConfigTracingPath, cfg.ConfigTracing)
+	var tracer tracing.Tracer
+	if cfg.TracingBackend == "otel" {
+		tracer = setupOTLPTracing(logger, cfg.OTLPEndpoint, tracingConfig)
+	} else if tracer, err = setupTracing(logger, tracingConfig); err != nil {
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
 	}
 	defer tracer.Shutdown(context.Background())
+	if t, ok := tracer.(configurableTracer); ok && cfg.ConfigTracingPath != "" {
+		go watchTracingConfig(ctx, logger, t, cfg.ConfigTracingPath, tracingConfig, tracingConfigPollInterval)
+	}
 
-	if err := c.StartReceiver(ctx, display); err != nil {
-		log.Fatal("Error during receiver's runtime: ", err)
+	// Resources opened during setup, such as buffered writers, are closed in
+	// reverse order once events stop being received, before the tracer is
+	// shut down.
+	var closeables []io.Closer
+	defer func() { closeAll(closeables) }()
+
+	// Ephemeral instances shut down on their own after MAX_RUNTIME.
+	runCtx := ctx
+	if cfg.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, cfg.MaxRuntime)
+		defer cancel()
+	}
+
+	if cfg.ReplayFile != "" {
+		runReplay(runCtx, logger, cfg)
+	} else {
+		runReceiver(runCtx, logger, eventLogger, cfg, &closeables)
+	}
+	if ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		logger.Info("Shut down after the maximum runtime", zap.Duration("maxRuntime", cfg.MaxRuntime))
 	}
 }
 
-// HTTP path of the health endpoint used for probing the service.
-const healthzPath = "/healthz"
+// closeAll closes the given resources in reverse order, logging failures.
+func closeAll(closeables []io.Closer) {
+	for i := len(closeables) - 1; i >= 0; i-- {
+		if err := closeables[i].Close(); err != nil {
+			zap.L().Error("Failed to close resource", zap.Error(err))
+		}
+	}
+}
+
+// runReceiver displays the events received until ctx is cancelled to
+// eventLogger. Resources which must be closed on shutdown are appended to
+// closeables.
+func runReceiver(ctx context.Context, logger, eventLogger *zap.Logger, cfg Config, closeables *[]io.Closer) {
+	if cfg.RequestLoggingEnabled {
+		logger.Warn("Request logging enabled, request logging is not recommended for production since it might log sensitive information")
+	}
+	// By default, events are displayed on a single line and requests are
+	// logged with an indent of 2 spaces.
+	eventIndent, requestIndent := "", "  "
+	if cfg.OutputIndent != "" {
+		// Validated with the config.
+		eventIndent, _ = parseIndent(cfg.OutputIndent)
+		requestIndent = eventIndent
+	}
+	requestLogOpts := requestLogOptions{
+		redactHeaders: cfg.RedactHeaders,
+		maxBodyBytes:  cfg.MaxLogBodyBytes,
+		indent:        requestIndent,
+	}
+	responseHeaders, err := parseResponseHeaders(cfg.ResponseHeaders)
+	if err != nil {
+		logger.Fatal("Invalid RESPONSE_HEADERS", zap.Error(err))
+	}
+	sinks := cfg.Sinks
+	if cfg.Sink != "" {
+		sinks = append([]string{cfg.Sink}, sinks...)
+	}
+	routes, err := parseSinkRoutes(cfg.Route)
+	if err != nil {
+		logger.Fatal("Invalid ROUTE", zap.Error(err))
+	}
 
-// healthzMiddleware is a cehttp.Middleware which exposes a health endpoint.
-func healthzMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		if req.RequestURI == healthzPath {
-			w.WriteHeader(http.StatusNoContent)
-		} else {
-			next.ServeHTTP(w, req)
+	// The receiver isn't ready until it is set up, nor while it handles too
+	// many requests, nor while no sink is reachable if sinks are probed.
+	ready := atomic.NewBool(false)
+	limiter := newConcurrencyLimiter(cfg.MaxConcurrency)
+	sinksReachable := func() bool { return true }
+	probed := append([]string(nil), sinks...)
+	for _, route := range routes {
+		probed = append(probed, route.sink)
+	}
+	if cfg.SinkProbeEnabled && len(probed) > 0 {
+		// Sinks are probed the way events are forwarded to them.
+		transport := newForwardTransport(cfg.ForwardInsecureSkipVerify, http.ProxyFromEnvironment)
+		prober := newSinkProber(probed, cfg.SinkProbeTimeout, transport)
+		go prober.Run(ctx, cfg.SinkProbeInterval)
+		sinksReachable = prober.Reachable
+	}
+	isReady := func() bool {
+		return ready.Load() && (cfg.UnhealthyInflight <= 0 || limiter.InFlight() < cfg.UnhealthyInflight) && sinksReachable()
+	}
+
+	// Middlewares are listed from the innermost to the outermost. Probes are
+	// answered first without being limited by MAX_CONCURRENCY nor logged by
+	// ACCESS_LOG, requests are identified before being logged, signatures are
+	// verified over the raw body, and the body is decompressed before being
+	// read by the other middlewares, then split if it is a batch.
+	opts := []cehttp.Option{
+		// The protocol would otherwise set its transport on
+		// http.DefaultClient, shared by the whole process.
+		cehttp.WithClient(http.Client{}),
+		cehttp.WithPath(cfg.ReceiverPath),
+		// Exposes the request to handlers, e.g. to display its binding mode.
+		cehttp.WithRequestDataAtContextMiddleware(),
+		cehttp.WithMiddleware(validationMiddleware(cfg.StrictValidation)),
+		cehttp.WithMiddleware(requestLoggingMiddleware(cfg.RequestLoggingEnabled, requestLogOpts)),
+		cehttp.WithMiddleware(batchMiddleware),
+		cehttp.WithMiddleware(gzipMiddleware(cfg.MaxDecompressedBytes)),
+		cehttp.WithMiddleware(signatureMiddleware([]byte(cfg.WebhookSecret))),
+		cehttp.WithMiddleware(concurrencyMiddleware(limiter)),
+		cehttp.WithMiddleware(accessLogMiddleware(cfg.AccessLog)),
+		cehttp.WithMiddleware(requestIDMiddleware),
+		cehttp.WithMiddleware(responseHeadersMiddleware(responseHeaders)),
+		cehttp.WithMiddleware(healthzMiddleware(cfg.HealthPath)),
+		cehttp.WithMiddleware(readyzMiddleware(isReady)),
+	}
+	// Events are received on the port, unless a listener is set up.
+	var l net.Listener
+	if cfg.ListenSocket != "" {
+		var err error
+		if l, err = listenUnix(cfg.ListenSocket); err != nil {
+			logger.Fatal("Failed to listen", zap.String("socket", cfg.ListenSocket), zap.Error(err))
+		}
+	} else if cfg.BindAddress != "" {
+		var err error
+		if l, err = net.Listen("tcp", cfg.BindAddress); err != nil {
+			logger.Fatal("Failed to listen", zap.String("address", cfg.BindAddress), zap.Error(err))
+		}
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		tlsConfig, err := newTLSConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		if err != nil {
+			logger.Fatal("Failed to configure TLS", zap.Error(err))
 		}
+		if l == nil {
+			if l, err = net.Listen("tcp", ":"+strconv.Itoa(cfg.Port)); err != nil {
+				logger.Fatal("Failed to listen", zap.Error(err))
+			}
+		}
+		l = tls.NewListener(l, tlsConfig)
+	}
+	// The middlewares don't apply to gRPC, whose server listens on the port
+	// unless a listener is set up.
+	if cfg.Protocol == "grpc" && l == nil {
+		if l, err = net.Listen("tcp", ":"+strconv.Itoa(cfg.Port)); err != nil {
+			logger.Fatal("Failed to listen", zap.Error(err))
+		}
+	}
+	if l != nil {
+		opts = append(opts, cehttp.WithListener(l))
+	} else {
+		opts = append(opts, cehttp.WithPort(cfg.Port))
+	}
+
+	var recent *eventBuffer
+	if cfg.EventBufferSize > 0 {
+		recent = newEventBuffer(cfg.EventBufferSize)
+	}
+	var tail *tailHub
+	if cfg.TailEnabled {
+		tail = newTailHub()
+		*closeables = append(*closeables, tail)
+	}
+
+	received := atomic.NewUint64(0)
+	metricsHandler := newMetricsHandler(metricsOptions{
+		pprofEnabled: cfg.PprofEnabled,
+		adminEnabled: cfg.AdminEnabled,
+		recent:       recent,
+		tail:         tail,
+		start:        time.Now(),
+		received:     received,
 	})
+	if cfg.SinglePort {
+		// Outermost, so that the endpoints aren't limited by MAX_CONCURRENCY.
+		opts = append(opts, cehttp.WithMiddleware(singlePortMiddleware(metricsHandler)))
+	} else {
+		metricsServer, err := startMetricsServer(strconv.Itoa(cfg.MetricsPort), metricsHandler)
+		if err != nil {
+			logger.Fatal("Failed to start metrics server", zap.Error(err))
+		}
+		defer metricsServer.Shutdown(context.Background())
+	}
+
+	var c cloudevents.Client
+	if cfg.Protocol == "http" {
+		if c, err = client.NewClientHTTP(opts, nil); err != nil {
+			logger.Fatal("Failed to create client", zap.Error(err))
+		}
+	}
+
+	var location *time.Location
+	if cfg.DisplayTimezone != "" {
+		if location, err = time.LoadLocation(cfg.DisplayTimezone); err != nil {
+			logger.Warn("Invalid DISPLAY_TIMEZONE, displaying times in UTC", zap.Error(err))
+			location = time.UTC
+		}
+	}
+	renderOpts := renderOptions{
+		extensions: parseDisplayedExtensions(cfg.DisplayExtensions),
+		location:   location,
+		rawData:    cfg.DisplayData == "raw",
+		indent:     eventIndent,
+		diff:       cfg.DiffMode,
+	}
+	var outputs []eventOutput
+	if cfg.Outputs != "" {
+		var closers []io.Closer
+		outputs, closers, err = parseOutputs(cfg.Outputs, cfg.LogLevel, renderOpts)
+		*closeables = append(*closeables, closers...)
+		if err != nil {
+			logger.Fatal("Invalid OUTPUTS", zap.Error(err))
+		}
+	} else {
+		renderer, err := newRenderer(cfg.OutputFormat, renderOpts)
+		if err != nil {
+			logger.Fatal("Failed to configure output", zap.Error(err))
+		}
+		outputs = []eventOutput{{logger: eventLogger, renderer: renderer, modeLine: cfg.OutputFormat == "pretty"}}
+	}
+
+	// In summary mode, events are accounted for in the summary instead of
+	// being displayed, after the same stages.
+	var handler eventHandler
+	if cfg.SummaryInterval > 0 {
+		summary := newEventSummary(time.Now())
+		go summary.Run(ctx, cfg.SummaryInterval)
+		*closeables = append(*closeables, summary)
+		handler = summarize(summary)
+	} else {
+		displayHeaders(outputs)
+		handler = displayOutputs(outputs, cfg.NackDisplayErrors)
+	}
+	if cfg.ExtractJSONPath != "" {
+		extractor, err := newJSONPathExtractor(cfg.ExtractJSONPath)
+		if err != nil {
+			logger.Fatal("Invalid EXTRACT_JSONPATH", zap.Error(err))
+		}
+		handler = extractJSONPath(extractor, handler)
+	}
+	if cfg.DataSchemaFile != "" {
+		schema, err := loadJSONSchema(cfg.DataSchemaFile)
+		if err != nil {
+			logger.Fatal("Invalid DATA_SCHEMA_FILE", zap.Error(err))
+		}
+		handler = validateDataSchema(schema, handler)
+	}
+	if cfg.HashBody {
+		// Hashes are only verified when forwarding, to check that events
+		// aren't corrupted before being passed on.
+		handler = hashData(len(sinks) > 0 || cfg.Route != "", handler)
+	}
+	if cfg.DisplaySampleRate < 1 {
+		handler = sampleEvents(cfg.DisplaySampleRate, cfg.AlwaysDisplayType, handler)
+	}
+	if cfg.DiscoveryMode {
+		handler = discoverEvents(newDiscoveredKinds(), handler)
+	}
+	if cfg.ProcessingDelay > 0 {
+		handler = delayEvents(cfg.ProcessingDelay, handler)
+	}
+	handler = measureEventData(cfg.LargeEventBytes, handler)
+	if tail != nil {
+		handler = tailEvents(tail, handler)
+	}
+	handler = countEvents(received, handler)
+	if cfg.MaxEvents > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		// Only displayed events count, not the ones dropped by sampling.
+		counts := func(cloudevents.Event) bool { return true }
+		if cfg.DisplaySampleRate < 1 {
+			counts = func(event cloudevents.Event) bool {
+				return passesSampling(event, cfg.DisplaySampleRate, cfg.AlwaysDisplayType)
+			}
+		}
+		handler = limitEvents(cfg.MaxEvents, counts, cancel, handler)
+	}
+	if recent != nil {
+		handler = bufferEvents(recent, handler)
+	}
+	if cfg.EventArchivePath != "" {
+		archive, err := openEventArchive(cfg.EventArchivePath)
+		if err != nil {
+			logger.Fatal("Failed to open event archive", zap.Error(err))
+		}
+		*closeables = append(*closeables, archive)
+		handler = archiveEvents(archive, handler)
+	}
+	if cfg.RouteByType {
+		router, err := newTypeRouter(cfg.RouteDir, cfg.MaxRoutedFiles)
+		if err != nil {
+			logger.Fatal("Failed to create type router", zap.Error(err))
+		}
+		*closeables = append(*closeables, router)
+		handler = routeEvents(router, handler)
+	}
+	senders := make(map[string]cloudevents.Client, len(sinks))
+	for _, sink := range sinks {
+		sender, err := newForwardClient(sink, cfg.ForwardInsecureSkipVerify, http.ProxyFromEnvironment)
+		if err != nil {
+			logger.Fatal("Failed to create forwarding client", zap.String("sink", sink), zap.Error(err))
+		}
+		senders[sink] = sender
+	}
+	for i, route := range routes {
+		if routes[i].sender, err = newForwardClient(route.sink, cfg.ForwardInsecureSkipVerify, http.ProxyFromEnvironment); err != nil {
+			logger.Fatal("Failed to create forwarding client", zap.String("sink", route.sink), zap.Error(err))
+		}
+	}
+	extension, err := parseForwardExtension(cfg.ForwardExtension)
+	if err != nil {
+		logger.Fatal("Invalid FORWARD_EXTENSION", zap.Error(err))
+	}
+	if len(senders) > 0 || len(routes) > 0 {
+		handler = forwardEvents(senders, forwardOptions{
+			required:   cfg.ForwardRequired,
+			maxRetries: cfg.ForwardMaxRetries,
+			baseDelay:  cfg.ForwardBaseDelay,
+			timeout:    cfg.ForwardTimeout,
+			routes:     routes,
+			extension:  extension,
+		}, handler)
+	}
+	handler = timeEvents(handler)
+	if cfg.ReplyEnabled {
+		handler = replyWithEvent(cfg.ReplyType, handler)
+	}
+	if cfg.Transform != "" {
+		transform, err := parseTransform(cfg.Transform)
+		if err != nil {
+			logger.Fatal("Invalid TRANSFORM", zap.Error(err))
+		}
+		handler = transformEvents(transform, handler)
+	}
+	if cfg.StampReceivedTime {
+		handler = stampReceivedTime(handler)
+	}
+	extensionFilter, err := parseExtensionFilter(cfg.FilterExtension)
+	if err != nil {
+		logger.Fatal("Invalid FILTER_EXTENSION", zap.Error(err))
+	}
+	handler = filterExtensions(extensionFilter, handler)
+	handler = filterTypePrefixes(cfg.FilterTypePrefix, handler)
+	handler = filterContentTypes(cfg.AllowedContentTypes, handler)
+	if cfg.FetchSchema {
+		handler = fetchSchemas(newSchemaFetcher(http.DefaultClient), handler)
+	}
+	if cfg.SequenceCheckEnabled {
+		checker, err := newSequenceChecker(cfg.MaxSequenceSources)
+		if err != nil {
+			logger.Fatal("Failed to create sequence checker", zap.Error(err))
+		}
+		handler = checkSequences(checker, handler)
+	}
+	if cfg.DedupWindow > 0 {
+		dedup := newDeduplicator(cfg.DedupWindow)
+		go dedup.Run(ctx)
+		handler = deduplicate(dedup, handler)
+	}
+	if cfg.MaxEventAge > 0 {
+		handler = rejectStaleEvents(ageLimit{
+			maxAge:      cfg.MaxEventAge,
+			skew:        cfg.ClockSkewTolerance,
+			requireTime: cfg.RequireEventTime,
+		}, handler)
+	}
+	if cfg.MaxEventsPerSecondPerSource > 0 {
+		limiter, err := newSourceRateLimiter(cfg.MaxEventsPerSecondPerSource, cfg.MaxRateLimitedSources)
+		if err != nil {
+			logger.Fatal("Failed to create rate limiter", zap.Error(err))
+		}
+		handler = rateLimitEvents(limiter, handler)
+	}
+	if cfg.FailRate > 0 {
+		seed := cfg.FailSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		handler = injectFailures(newFailureInjector(cfg.FailRate, seed), handler)
+	}
+
+	ready.Store(true)
+	switch cfg.Protocol {
+	case "grpc":
+		err = serveGRPC(ctx, l, handler)
+	case "mqtt":
+		err = serveMQTT(ctx, mqttOptions{broker: cfg.MQTTBroker, topic: cfg.MQTTTopic, clientID: cfg.MQTTClientID}, handler)
+	default:
+		err = c.StartReceiver(ctx, handler)
+	}
+	if err != nil {
+		// Fatal exits without running deferred calls.
+		closeAll(*closeables)
+		logger.Fatal("Error during receiver's runtime", zap.Error(err))
+	}
+	// This line is meant to be matched by scripts, its format must not change.
+	if !cfg.Quiet {
+		log.Printf("received %d events", received.Load())
+	}
+}
+
+// countEvents returns an eventHandler which increments count for each event
+// before passing it to next.
+func countEvents(count *atomic.Uint64, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		count.Inc()
+		return next(ctx, event)
+	}
 }
 
-// requestLoggingMiddleware is a cehttp.Middleware which logs incoming requests.
-func requestLoggingMiddleware(enabled bool) func(next http.Handler) http.Handler {
+// delayEvents returns an eventHandler which waits for the given delay before
+// passing each event to next, to simulate a slow consumer. Events whose
+// context is cancelled meanwhile are rejected without being passed to next.
+func delayEvents(delay time.Duration, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		select {
+		case <-time.After(delay):
+			return next(ctx, event)
+		case <-ctx.Done():
+			return nil, cehttp.NewResult(http.StatusServiceUnavailable, "cancelled while processing: %v", ctx.Err())
+		}
+	}
+}
+
+// listenUnix listens on the Unix domain socket at the given path. A socket
+// left over at the path by a previous run is removed first. The socket file
+// is removed once the returned listener is closed.
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// limitEvents returns an eventHandler which passes at most max events for which
+// counts returns true to next, and calls done once the last of them is
+// handled. Other events are passed to next until the limit is reached. Events
+// beyond the limit are rejected with a 503, so that senders retry them
+// elsewhere.
+func limitEvents(max uint64, counts func(cloudevents.Event) bool, done func(), next eventHandler) eventHandler {
+	var count atomic.Uint64
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if !counts(event) {
+			if count.Load() >= max {
+				return nil, cehttp.NewResult(http.StatusServiceUnavailable, "maximum number of events reached")
+			}
+			return next(ctx, event)
+		}
+		n := count.Inc()
+		if n > max {
+			return nil, cehttp.NewResult(http.StatusServiceUnavailable, "maximum number of events reached")
+		}
+		reply, result := next(ctx, event)
+		if n == max {
+			zap.L().Info("Shutting down after the maximum number of events", zap.Uint64("maxEvents", max))
+			done()
+		}
+		return reply, result
+	}
+}
+
+// timeEvents returns an eventHandler which measures how long next takes to
+// handle each event.
+func timeEvents(next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		start := time.Now()
+		reply, result := next(ctx, event)
+		elapsed := time.Since(start)
+		eventProcessing.WithLabelValues().Observe(elapsed.Seconds())
+		zap.L().Debug("Processed event", zap.String("id", event.ID()), zap.Duration("duration", elapsed))
+		return reply, result
+	}
+}
+
+// measureEventData returns an eventHandler which records the size of the data
+// of each event before passing it to next, counting events whose data is
+// larger than the given number of bytes.
+func measureEventData(largeBytes int, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		size := len(event.DataEncoded)
+		eventDataBytes.WithLabelValues().Observe(float64(size))
+		if size > largeBytes {
+			largeEvents.WithLabelValues().Inc()
+		}
+		return next(ctx, event)
+	}
+}
+
+// Default HTTP path of the health endpoint used for probing the service.
+const healthzPath = "/healthz"
+
+// healthzMiddleware returns a cehttp.Middleware which exposes a health
+// endpoint at the given path.
+func healthzMiddleware(path string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			if enabled {
-				logRequest(req)
+			if req.RequestURI == path {
+				w.WriteHeader(http.StatusNoContent)
+			} else {
+				next.ServeHTTP(w, req)
 			}
-			next.ServeHTTP(w, req)
 		})
 	}
 }
 
+// HTTP path of the readiness endpoint used for probing the service.
+const readyzPath = "/readyz"
+
+// readyzMiddleware returns a cehttp.Middleware which exposes a readiness
+// endpoint. The endpoint reports a failure while ready returns false.
+func readyzMiddleware(ready func() bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case req.RequestURI != readyzPath:
+				next.ServeHTTP(w, req)
+			case ready():
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+// requestLogOptions configures how incoming requests are logged.
+type requestLogOptions struct {
+	// Headers whose values are redacted from the logs.
+	redactHeaders []string
+	// Maximum number of body bytes logged. The body isn't truncated when this
+	// isn't positive.
+	maxBodyBytes int64
+	// Indent of logged requests, on a single line when empty.
+	indent string
+}
+
+// requestLoggingMiddleware is a cehttp.Middleware which logs incoming requests,
+// along with the status of their response.
+func requestLoggingMiddleware(enabled bool, opts requestLogOptions) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !enabled {
+				next.ServeHTTP(w, req)
+				return
+			}
+			// The body is read before being consumed by the next handlers, from
+			// a buffer returned to the pool once they are done.
+			body := getBuffer()
+			defer putBuffer(body)
+			loggable := toReq(req, opts, body)
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, req)
+			loggable.Status = rec.Status()
+			logRequest(loggable, opts.indent, requestIDFields(req.Context())...)
+		})
+	}
+}
+
+// accessLogMiddleware is a cehttp.Middleware which logs a line per handled
+// request, with its method, path, response status and duration, but neither
+// its headers nor its body.
+func accessLogMiddleware(enabled bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, req)
+			zap.L().Info("Handled request", append([]zap.Field{
+				zap.String("method", req.Method),
+				zap.String("path", req.URL.Path),
+				zap.Int("status", rec.Status()),
+				zap.Duration("duration", time.Since(start)),
+			}, requestIDFields(req.Context())...)...)
+		})
+	}
+}
+
+// statusRecorder is a http.ResponseWriter which records the status code of
+// the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Status returns the status code of the response, 200 if none was written.
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
 type LoggableRequest struct {
 	Method           string      `json:"method,omitempty"`
 	URL              *url.URL    `json:"URL,omitempty"`
@@ -163,33 +865,55 @@ type LoggableRequest struct {
 	Trailer          http.Header `json:"trailer,omitempty"`
 	RemoteAddr       string      `json:"remoteAddr"`
 	RequestURI       string      `json:"requestURI"`
+	Status           int         `json:"status"`
 }
 
-func logRequest(req *http.Request) {
-	b, err := json.MarshalIndent(toReq(req), "", "  ")
+func logRequest(req LoggableRequest, indent string, fields ...zap.Field) {
+	b, err := marshalJSON(req, indent)
 	if err != nil {
-		log.Println("failed to marshal request", err)
+		zap.L().Error("Failed to marshal request", zap.Error(err))
 	}
 
-	log.Println(string(b))
+	zap.L().Info(string(b), fields...)
 }
 
-func toReq(req *http.Request) LoggableRequest {
-	body, err := io.ReadAll(req.Body)
+// Value replacing redacted header values in logged requests.
+const redactedValue = "***REDACTED***"
+
+// toReq returns the loggable form of req, whose body is read into full and
+// replaced with a reader of full. full must not be reused until req is handled.
+func toReq(req *http.Request, opts requestLogOptions, full *bytes.Buffer) LoggableRequest {
+	// Only the logged part of the body is read through the limit, but all of
+	// it is kept in full for the next handlers.
+	var r io.Reader = io.TeeReader(req.Body, full)
+	if opts.maxBodyBytes > 0 {
+		r = io.LimitReader(r, opts.maxBodyBytes)
+	}
+	logged := getBuffer()
+	defer putBuffer(logged)
+	if _, err := logged.ReadFrom(r); err != nil {
+		zap.L().Error("Failed to read request body", zap.Error(err))
+	}
+	truncated, err := io.Copy(full, req.Body)
 	if err != nil {
-		log.Println("failed to read request body")
+		zap.L().Error("Failed to read request body", zap.Error(err))
 	}
 	_ = req.Body.Close()
 	// Replace the body with a new reader after reading from the original
-	req.Body = io.NopCloser(bytes.NewBuffer(body))
+	req.Body = io.NopCloser(full)
+
+	loggedBody := logged.String()
+	if truncated > 0 {
+		loggedBody += fmt.Sprintf("...[truncated %d bytes]", truncated)
+	}
 	return LoggableRequest{
 		Method:           req.Method,
 		URL:              req.URL,
 		Proto:            req.Proto,
 		ProtoMajor:       req.ProtoMajor,
 		ProtoMinor:       req.ProtoMinor,
-		Header:           req.Header,
-		Body:             string(body),
+		Header:           redact(req.Header, opts.redactHeaders),
+		Body:             loggedBody,
 		ContentLength:    req.ContentLength,
 		TransferEncoding: req.TransferEncoding,
 		Host:             req.Host,
@@ -198,3 +922,25 @@ func toReq(req *http.Request) LoggableRequest {
 		RequestURI:       req.RequestURI,
 	}
 }
+
+// redact returns a copy of header in which the values of the given headers,
+// matched case-insensitively, are replaced with redactedValue.
+func redact(header http.Header, names []string) http.Header {
+	if len(names) == 0 {
+		return header
+	}
+	header = header.Clone()
+	for key, values := range header {
+		for _, name := range names {
+			if strings.EqualFold(key, name) {
+				redacted := make([]string, len(values))
+				for i := range redacted {
+					redacted[i] = redactedValue
+				}
+				header[key] = redacted
+				break
+			}
+		}
+	}
+	return header
+}
@@ -17,25 +17,39 @@ limitations under the License.
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/google/go-cmp/cmp"
+	"github.com/phayes/freeport"
+	"go.opencensus.io/trace"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
 )
 
 const ceClientURL = "http://localhost:8080"
 
 func TestRun_HealthEndpoint(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	t.Cleanup(cancel)
-
-	go run(ctx)
-	if err := waitForClient(ctx); err != nil {
-		t.Fatal("Error waiting for CloudEvents receiver:", err)
-	}
+	startRun(t, testConfig(t))
 
 	const healthzURL = ceClientURL + healthzPath
 	const expectStatusCode = http.StatusNoContent
@@ -59,9 +73,754 @@ func TestRun_HealthEndpoint(t *testing.T) {
 	}
 }
 
-// waitForClient sends requests to the local CloudEvents receiver address until
+func TestRun_CustomHealthPath(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.HealthPath = "/_health"
+	startRun(t, cfg)
+
+	resp, err := http.Get(ceClientURL + "/_health")
+	if err != nil {
+		t.Fatal("Error sending GET request to health endpoint:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Error("Unexpected status code sending GET request to the custom health endpoint:", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ceClientURL + healthzPath)
+	if err != nil {
+		t.Fatal("Error sending GET request to the default health endpoint:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		t.Error("Expected the default health endpoint not to respond once the path is customized")
+	}
+}
+
+func TestRun_GracefulShutdown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+
+	runCtx, stop := context.WithCancel(ctx)
+	cfg := testConfig(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(runCtx, cfg)
+	}()
+	if err := waitForClient(ctx, ceClientURL); err != nil {
+		t.Fatal("Error waiting for CloudEvents receiver:", err)
+	}
+
+	stop()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("Receiver did not stop after its context was cancelled")
+	}
+}
+
+func TestRun_ClosesOnShutdown(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SummaryInterval = time.Hour
+	buf := captureLog(t)
+	stop := startRun(t, cfg)
+	sendEvent(t, newTestEvent(t))
+
+	stop()
+
+	// The summary is only reported hourly, the final report is emitted on
+	// shutdown.
+	if out := buf.String(); !strings.Contains(out, "Events summary") || !strings.Contains(out, `"total": 1`) {
+		t.Errorf("Expected a final summary of 1 event on shutdown, got:\n%s", out)
+	}
+}
+
+func TestRun_MaxRuntime(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxRuntime = 200 * time.Millisecond
+	cfg.SummaryInterval = time.Hour
+	buf := captureLog(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(context.Background(), cfg)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := waitForClient(ctx, ceClientURL); err != nil {
+		t.Fatal("Error waiting for CloudEvents receiver:", err)
+	}
+	sendEvent(t, newTestEvent(t))
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the receiver to stop after the maximum runtime")
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Shut down after the maximum runtime") {
+		t.Errorf("Expected the shutdown to be logged, got:\n%s", out)
+	}
+	if !strings.Contains(out, "Events summary") || !strings.Contains(out, `"total": 1`) {
+		t.Errorf("Expected a final summary of 1 event on shutdown, got:\n%s", out)
+	}
+}
+
+func TestRun_MaxEvents(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxEvents = 2
+	buf := captureLog(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx, cfg)
+	}()
+	if err := waitForClient(ctx, ceClientURL); err != nil {
+		t.Fatal("Error waiting for CloudEvents receiver:", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		event := newTestEvent(t)
+		event.SetID("max-events-" + strconv.Itoa(i))
+		res := sendEvent(t, event)
+		if gotACK := cloudevents.IsACK(res); gotACK != (i <= 2) {
+			t.Errorf("Expected event %d to be acknowledged: %t, got: %v", i, i <= 2, res)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("Expected the receiver to stop after the maximum number of events")
+	}
+	out := buf.String()
+	for _, want := range []string{"max-events-1", "max-events-2", "received 2 events"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "max-events-3") {
+		t.Errorf("Expected the event beyond the limit not to be displayed, got:\n%s", out)
+	}
+}
+
+func TestRun_MaxEventsSampled(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxEvents = 2
+	cfg.DisplaySampleRate = 0.5
+	buf := captureLog(t)
+
+	// Events dropped by sampling come first, and don't count.
+	var ids []string
+	for i := 0; len(ids) < 2; i++ {
+		if id := "sampled-out-" + strconv.Itoa(i); !isSampled(id, cfg.DisplaySampleRate) {
+			ids = append(ids, id)
+		}
+	}
+	for i := 0; len(ids) < 4; i++ {
+		if id := "sampled-" + strconv.Itoa(i); isSampled(id, cfg.DisplaySampleRate) {
+			ids = append(ids, id)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx, cfg)
+	}()
+	if err := waitForClient(ctx, ceClientURL); err != nil {
+		t.Fatal("Error waiting for CloudEvents receiver:", err)
+	}
+
+	for _, id := range ids {
+		event := newTestEvent(t)
+		event.SetID(id)
+		if res := sendEvent(t, event); !cloudevents.IsACK(res) {
+			t.Errorf("Expected event %s to be acknowledged, got: %v", id, res)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("Expected the receiver to stop after the maximum number of displayed events")
+	}
+	out := buf.String()
+	for _, id := range ids[2:] {
+		if !strings.Contains(out, id) {
+			t.Errorf("Expected the sampled event %s to be displayed, got:\n%s", id, out)
+		}
+	}
+}
+
+func TestRun_ReceivedCount(t *testing.T) {
+	buf := captureLog(t)
+	stop := startRun(t, testConfig(t))
+	for i := 0; i < 3; i++ {
+		sendEvent(t, newTestEvent(t))
+	}
+
+	stop()
+
+	if out := buf.String(); !strings.Contains(out, "\nreceived 3 events\n") {
+		t.Errorf("Expected the number of received events on exit, got:\n%s", out)
+	}
+}
+
+func TestRun_BindingMode(t *testing.T) {
+	out := captureLog(t)
+	startRun(t, testConfig(t))
+
+	// The SDK sends events in binary mode by default.
+	sendEvent(t, newTestEvent(t))
+	if !strings.Contains(out.String(), "\nmode: binary") || !strings.Contains(out.String(), `"mode": "binary"`) {
+		t.Errorf("Expected the binary mode to be displayed, got:\n%s", out)
+	}
+	out.Reset()
+
+	event := newTestEvent(t)
+	body, err := event.MarshalJSON()
+	if err != nil {
+		t.Fatal("Error marshaling event:", err)
+	}
+	resp, err := http.Post(ceClientURL, cloudevents.ApplicationCloudEventsJSON, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal("Error sending structured event:", err)
+	}
+	resp.Body.Close()
+	if !strings.Contains(out.String(), "\nmode: structured") || !strings.Contains(out.String(), `"mode": "structured"`) {
+		t.Errorf("Expected the structured mode to be displayed, got:\n%s", out)
+	}
+}
+
+func TestCloseAll(t *testing.T) {
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	w.WriteString("tail")
+
+	var order []string
+	closeAll([]io.Closer{
+		testCloser(func() error {
+			order = append(order, "first")
+			return nil
+		}),
+		testCloser(func() error {
+			order = append(order, "buffered")
+			return w.Flush()
+		}),
+	})
+
+	if got := out.String(); got != "tail" {
+		t.Errorf("Expected the buffered writer to be flushed, got %q", got)
+	}
+	if diff := cmp.Diff([]string{"buffered", "first"}, order); diff != "" {
+		t.Error("Unexpected closing order (-want, +got):", diff)
+	}
+}
+
+// testCloser is an io.Closer calling the underlying function.
+type testCloser func() error
+
+func (c testCloser) Close() error { return c() }
+
+func TestRun_SummaryProcessingDelay(t *testing.T) {
+	buf := captureLog(t)
+	cfg := testConfig(t)
+	cfg.SummaryInterval = time.Hour
+	cfg.ProcessingDelay = 100 * time.Millisecond
+	stop := startRun(t, cfg)
+
+	start := time.Now()
+	if res := sendEvent(t, newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Fatal("Failed to send event:", res)
+	}
+	if elapsed := time.Since(start); elapsed < cfg.ProcessingDelay {
+		t.Errorf("Expected the event to be delayed by %v in summary mode, it took %v", cfg.ProcessingDelay, elapsed)
+	}
+	stop()
+	if out := buf.String(); !strings.Contains(out, "Events summary") || !strings.Contains(out, `"total": 1`) {
+		t.Errorf("Expected a final summary of 1 event, got:\n%s", out)
+	}
+}
+
+func TestDelayEvents(t *testing.T) {
+	handled := make(chan struct{}, 2)
+	handler := delayEvents(time.Hour, func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		handled <- struct{}{}
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	_, res := handler(ctx, newTestEvent(t))
+	if cloudevents.IsACK(res) {
+		t.Error("Expected event cancelled while delayed to be rejected, got:", res)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("Expected the handler to return once cancelled, returned after", elapsed)
+	}
+	if len(handled) != 0 {
+		t.Error("Expected event cancelled while delayed not to be handled")
+	}
+
+	handler = delayEvents(time.Millisecond, func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		handled <- struct{}{}
+		return nil, nil
+	})
+	if _, res := handler(context.Background(), newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Error("Expected delayed event to be acknowledged, got:", res)
+	}
+	if len(handled) != 1 {
+		t.Error("Expected delayed event to be handled")
+	}
+}
+
+func TestDisplay_Span(t *testing.T) {
+	exporter := &testSpanExporter{}
+	trace.RegisterExporter(exporter)
+	t.Cleanup(func() { trace.UnregisterExporter(exporter) })
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	t.Cleanup(func() { trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)}) })
+
+	captureLog(t)
+	first, second := newTestEvent(t), newTestEvent(t)
+	second.SetID("2")
+
+	ctx, parent := trace.StartSpan(context.Background(), "receive")
+	for _, event := range []cloudevents.Event{first, second} {
+		display(zap.L(), compactRenderer{})(ctx, event)
+	}
+	parent.End()
+
+	spans := exporter.spans("display")
+	if len(spans) != 2 {
+		t.Fatal("Expected one display span per event, got", len(spans))
+	}
+	for i, event := range []cloudevents.Event{first, second} {
+		want := map[string]interface{}{
+			"ce.type":   event.Type(),
+			"ce.source": event.Source(),
+			"ce.id":     event.ID(),
+		}
+		if diff := cmp.Diff(want, spans[i].Attributes); diff != "" {
+			t.Errorf("Unexpected attributes of span %d (-want, +got): %s", i, diff)
+		}
+		if spans[i].ParentSpanID != parent.SpanContext().SpanID {
+			t.Errorf("Expected span %d to be a child of the incoming span", i)
+		}
+	}
+}
+
+func TestDisplay_RenderError(t *testing.T) {
+	out := captureLog(t)
+	errorsBefore := counterValue(t, "display_errors_total", nil)
+
+	event := newTestEvent(t)
+	handler := displayOutputs([]eventOutput{
+		{logger: zap.L(), renderer: failingRenderer{}},
+		{logger: zap.L(), renderer: compactRenderer{}},
+	}, false)
+	if _, res := handler(context.Background(), event); res != nil {
+		t.Error("Expected event to be acknowledged, got:", res)
+	}
+
+	if got := counterValue(t, "display_errors_total", nil) - errorsBefore; got != 1 {
+		t.Error("Expected one display error to be counted, got", got)
+	}
+	logged := out.String()
+	if !strings.Contains(logged, "Failed to render event") || !strings.Contains(logged, event.ID()) {
+		t.Errorf("Expected the error to be logged with the event id, got:\n%s", logged)
+	}
+	if !strings.Contains(logged, `"type": dev.knative.eventing.samples.heartbeat`) {
+		t.Errorf("Expected the event to be displayed to the other outputs, got:\n%s", logged)
+	}
+}
+
+func TestDisplay_NackErrors(t *testing.T) {
+	captureLog(t)
+	event := newTestEvent(t)
+
+	handler := displayOutputs([]eventOutput{{logger: zap.L(), renderer: compactRenderer{}}}, true)
+	if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+		t.Error("Expected displayed event to be acknowledged, got:", res)
+	}
+
+	handler = displayOutputs([]eventOutput{
+		{logger: zap.L(), renderer: failingRenderer{}},
+		{logger: zap.L(), renderer: compactRenderer{}},
+	}, true)
+	_, res := handler(context.Background(), event)
+	var result *cehttp.Result
+	if !cloudevents.ResultAs(res, &result) || result.StatusCode != http.StatusInternalServerError {
+		t.Error("Expected event failing to be rendered to be rejected with a 500, got:", res)
+	}
+}
+
+// failingRenderer is an eventRenderer which fails to render any Event.
+type failingRenderer struct{}
+
+func (failingRenderer) Render(cloudevents.Event) (string, error) {
+	return "", errors.New("unsupported extension value")
+}
+
+// testSpanExporter is a trace.Exporter recording exported spans in memory.
+type testSpanExporter struct {
+	mu       sync.Mutex
+	exported []*trace.SpanData
+}
+
+func (e *testSpanExporter) ExportSpan(s *trace.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.exported = append(e.exported, s)
+}
+
+// spans returns the exported spans with the given name, in order of export.
+func (e *testSpanExporter) spans(name string) []*trace.SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var spans []*trace.SpanData
+	for _, s := range e.exported {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+// startRun runs the receiver with the given configuration in the background,
+// and waits for it to accept requests. The receiver runs until the test ends
+// or the returned function is called, which waits for run to return.
+func startRun(t *testing.T, cfg Config) (stop func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx, cfg)
+	}()
+	stop = func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+
+	if err := waitForClient(ctx, "http://localhost:"+strconv.Itoa(cfg.Port)); err != nil {
+		t.Fatal("Error waiting for CloudEvents receiver:", err)
+	}
+	return stop
+}
+
+func TestRun_ListenSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "event_display.sock")
+	cfg := testConfig(t)
+	cfg.ListenSocket = socket
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx, cfg)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	httpClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	sender, err := cloudevents.NewClientHTTP(cloudevents.WithTarget("http://event-display/"), cehttp.WithClient(*httpClient))
+	if err != nil {
+		t.Fatal("Error creating CloudEvents client:", err)
+	}
+
+	var res cloudevents.Result
+	for ctx.Err() == nil {
+		if res = sender.Send(ctx, newTestEvent(t)); cloudevents.IsACK(res) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !cloudevents.IsACK(res) {
+		t.Fatal("Failed to send event over the Unix socket:", res)
+	}
+
+	cancel()
+	<-done
+	if _, err := os.Stat(socket); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the socket file to be removed on shutdown, got:", err)
+	}
+}
+
+func TestRun_BindAddressIPv6(t *testing.T) {
+	// Pick a free port on the IPv6 loopback address.
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 isn't available:", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cfg := testConfig(t)
+	cfg.BindAddress = addr
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx, cfg)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if err := waitForClient(ctx, "http://"+addr); err != nil {
+		t.Fatal("Error waiting for CloudEvents receiver:", err)
+	}
+	if res := newTestSender(t, "http://"+addr).Send(ctx, newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Fatal("Failed to send event over IPv6:", res)
+	}
+}
+
+func TestRun_PortAndPath(t *testing.T) {
+	port, err := freeport.GetFreePort()
+	if err != nil {
+		t.Fatal("Error getting a free port:", err)
+	}
+	cfg := testConfig(t)
+	cfg.Port = port
+	cfg.ReceiverPath = "/events"
+	startRun(t, cfg)
+
+	baseURL := "http://localhost:" + strconv.Itoa(port)
+
+	if res := newTestSender(t, baseURL+"/events").Send(context.Background(), newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Error("Failed to send event to the configured path:", res)
+	}
+	if res := newTestSender(t, baseURL+"/other").Send(context.Background(), newTestEvent(t)); cloudevents.IsACK(res) {
+		t.Error("Expected event sent to another path to be rejected")
+	}
+
+	resp, err := http.Get(baseURL + healthzPath)
+	if err != nil {
+		t.Fatal("Error sending GET request to health endpoint:", err)
+	}
+	if gotStatusCode := resp.StatusCode; gotStatusCode != http.StatusNoContent {
+		t.Error("Unexpected status code sending GET request to health endpoint:", gotStatusCode)
+	}
+}
+
+func TestRun_SinglePort(t *testing.T) {
+	ports, err := freeport.GetFreePorts(2)
+	if err != nil {
+		t.Fatal("Error getting free ports:", err)
+	}
+	cfg := testConfig(t)
+	cfg.Port = ports[0]
+	cfg.MetricsPort = ports[1]
+	cfg.ReceiverPath = "/ce"
+	cfg.SinglePort = true
+	startRun(t, cfg)
+
+	baseURL := "http://localhost:" + strconv.Itoa(cfg.Port)
+
+	if res := newTestSender(t, baseURL+"/ce").Send(context.Background(), newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Error("Failed to send event to the receiver path:", res)
+	}
+	for path, want := range map[string]int{
+		healthzPath: http.StatusNoContent,
+		readyzPath:  http.StatusNoContent,
+		metricsPath: http.StatusOK,
+	} {
+		resp, err := http.Get(baseURL + path)
+		if err != nil {
+			t.Fatalf("Error sending GET request to %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Unexpected status code sending GET request to %s: %d", path, resp.StatusCode)
+		}
+	}
+
+	if _, err := http.Get("http://localhost:" + strconv.Itoa(cfg.MetricsPort) + metricsPath); err == nil {
+		t.Error("Expected the metrics server not to listen on the metrics port")
+	}
+}
+
+func TestLogRequest_RedactHeaders(t *testing.T) {
+	const secret = "Bearer s3cr3t"
+
+	req, err := http.NewRequest("POST", "https://localhost", bytes.NewBufferString("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header["authorization"] = []string{secret}
+	req.Header.Add("Cookie", "session=s3cr3t")
+	req.Header.Add("Content-Type", "application/json")
+
+	out := captureLog(t)
+	logRequest(toReq(req, requestLogOptions{redactHeaders: splitList("Authorization,COOKIE")}, new(bytes.Buffer)), "  ")
+
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("Expected sensitive header values to be redacted, got:\n%s", out)
+	}
+	if !strings.Contains(out.String(), redactedValue) {
+		t.Errorf("Expected redacted header values to be logged as %q, got:\n%s", redactedValue, out)
+	}
+	if !strings.Contains(out.String(), "application/json") {
+		t.Errorf("Expected other header values to be logged, got:\n%s", out)
+	}
+	if got := req.Header.Get("Cookie"); got != "session=s3cr3t" {
+		t.Error("Expected request headers to be left untouched, got Cookie:", got)
+	}
+}
+
+func TestLogRequest_TruncateBody(t *testing.T) {
+	const maxBodyBytes = 64 << 10
+	bodyContent := strings.Repeat("x", 1<<20)
+
+	req, err := http.NewRequest("POST", "https://localhost", bytes.NewBufferString(bodyContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureLog(t)
+	logRequest(toReq(req, requestLogOptions{maxBodyBytes: maxBodyBytes}, new(bytes.Buffer)), "  ")
+
+	wantTruncated := fmt.Sprintf("...[truncated %d bytes]", len(bodyContent)-maxBodyBytes)
+	if !strings.Contains(out.String(), wantTruncated) {
+		t.Errorf("Expected logged body to be truncated with %q", wantTruncated)
+	}
+	if out.Len() > 2*maxBodyBytes {
+		t.Errorf("Expected logged request to be at most %d bytes, got %d", 2*maxBodyBytes, out.Len())
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != bodyContent {
+		t.Errorf("Expected handler to get the full body of %d bytes, got %d bytes", len(bodyContent), len(body))
+	}
+}
+
+func TestRequestLoggingMiddleware_Status(t *testing.T) {
+	handler := requestLoggingMiddleware(true, requestLogOptions{indent: "  "})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+	}))
+
+	out := captureLog(t)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("hello")))
+
+	if want := `"status": 400`; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected the logged request to contain %s, got:\n%s", want, out)
+	}
+}
+
+func BenchmarkRequestLoggingMiddleware(b *testing.B) {
+	logger, err := newLogger(io.Discard, "info")
+	if err != nil {
+		b.Fatal("Error creating logger:", err)
+	}
+	defer zap.ReplaceGlobals(logger)()
+
+	body := strings.Repeat(`{"id":2,"label":"heartbeat"}`, 64)
+	handler := requestLoggingMiddleware(true, requestLogOptions{maxBodyBytes: 1024})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.Copy(io.Discard, req.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	handler := accessLogMiddleware(true)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	out := captureLog(t)
+	req := httptest.NewRequest(http.MethodPost, "/events?x=1", bytes.NewBufferString("s3cr3t"))
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, want := range []string{`"method": "POST"`, `"path": "/events"`, `"status": 202`, `"duration": `} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected the access log to contain %s, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("Expected neither headers nor body to be logged, got:\n%s", out)
+	}
+}
+
+// sendEvent sends the given event to the local CloudEvents receiver.
+func sendEvent(t *testing.T, event cloudevents.Event) cloudevents.Result {
+	t.Helper()
+	return newTestSender(t, ceClientURL).Send(context.Background(), event)
+}
+
+func TestReadyzMiddleware(t *testing.T) {
+	ready := atomic.NewBool(false)
+	handler := healthzMiddleware(healthzPath)(readyzMiddleware(ready.Load)(http.NotFoundHandler()))
+
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if got := probe(readyzPath); got != http.StatusServiceUnavailable {
+		t.Error("Unexpected readiness status code before being ready:", got)
+	}
+	if got := probe(healthzPath); got != http.StatusNoContent {
+		t.Error("Unexpected health status code before being ready:", got)
+	}
+
+	ready.Store(true)
+
+	if got := probe(readyzPath); got != http.StatusNoContent {
+		t.Error("Unexpected readiness status code after being ready:", got)
+	}
+	if got := probe(healthzPath); got != http.StatusNoContent {
+		t.Error("Unexpected health status code after being ready:", got)
+	}
+}
+
+func TestRun_ReadyzEndpoint(t *testing.T) {
+	startRun(t, testConfig(t))
+
+	resp, err := http.Get(ceClientURL + readyzPath)
+	if err != nil {
+		t.Fatal("Error sending GET request to readiness endpoint:", err)
+	}
+	if gotStatusCode := resp.StatusCode; gotStatusCode != http.StatusNoContent {
+		t.Error("Unexpected status code sending GET request to readiness endpoint:", gotStatusCode)
+	}
+}
+
+// waitForClient sends requests to the given CloudEvents receiver address until
 // a HTTP response is received, or until ctx is cancelled.
-func waitForClient(ctx context.Context) error {
+func waitForClient(ctx context.Context, url string) error {
 	httpClient := http.Client{}
 	var httpErr error
 
@@ -70,7 +829,7 @@ func waitForClient(ctx context.Context) error {
 	for {
 		select {
 		case <-tick:
-			req, err := http.NewRequestWithContext(ctx, http.MethodHead, ceClientURL, nil)
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
 			if err != nil {
 				return fmt.Errorf("creating HTTP request: %w", err)
 			}
@@ -97,7 +856,7 @@ func TestLogRequest(t *testing.T) {
 
 	req.Header.Add("content-type", "application/json")
 
-	logRequest(req)
+	logRequest(toReq(req, requestLogOptions{}, new(bytes.Buffer)), "  ")
 
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
@@ -108,3 +867,128 @@ func TestLogRequest(t *testing.T) {
 		t.Fatal("got", string(body), "want", bodyContent)
 	}
 }
+
+func TestRun_DocumentFormats(t *testing.T) {
+	for _, format := range []string{"json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			captureLog(t)
+			eventOut := new(bytes.Buffer)
+			cfg := testConfig(t)
+			cfg.OutputFormat = format
+			cfg.EventOutput = eventOut
+			stop := startRun(t, cfg)
+			event := newTestEvent(t)
+			if res := sendEvent(t, event); !cloudevents.IsACK(res) {
+				t.Fatal("Failed to send event:", res)
+			}
+			stop()
+
+			// The output must be a document as is, without level nor fields.
+			var got map[string]interface{}
+			var err error
+			if format == "json" {
+				err = json.Unmarshal(eventOut.Bytes(), &got)
+			} else {
+				err = yaml.Unmarshal(eventOut.Bytes(), &got)
+			}
+			if err != nil {
+				t.Fatalf("Failed to decode output as %s: %v\n%s", format, err, eventOut)
+			}
+			if got["id"] != event.ID() || got["type"] != event.Type() {
+				t.Errorf("Expected the event to be decoded, got %v", got)
+			}
+		})
+	}
+}
+
+func TestRun_Quiet(t *testing.T) {
+	out := captureLog(t)
+	cfg := testConfig(t)
+	cfg.Quiet = true
+	cfg.OutputFormat = "compact"
+	// Operational logs such as this warning must not be written.
+	cfg.RequestLoggingEnabled = true
+	stop := startRun(t, cfg)
+	if res := sendEvent(t, newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Fatal("Failed to send event:", res)
+	}
+	stop()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"type": dev.knative.eventing.samples.heartbeat`) {
+		t.Errorf("Expected only the event to be written, got:\n%s", out)
+	}
+}
+
+func TestRun_OutputIndent(t *testing.T) {
+	testCases := map[string]struct {
+		indent      string
+		wantEvent   string
+		wantRequest string
+	}{
+		"default": {
+			wantEvent:   `{"specversion":"1.0",`,
+			wantRequest: "{\n  \"method\": \"POST\",",
+		},
+		"tab": {
+			indent:      "tab",
+			wantEvent:   "{\n\t\"specversion\": \"1.0\",",
+			wantRequest: "{\n\t\"method\": \"POST\",",
+		},
+		"spaces": {
+			indent:      "4",
+			wantEvent:   "{\n    \"specversion\": \"1.0\",",
+			wantRequest: "{\n    \"method\": \"POST\",",
+		},
+		"compact": {
+			indent:      "compact",
+			wantEvent:   `{"specversion":"1.0",`,
+			wantRequest: `{"method":"POST",`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out := captureLog(t)
+			cfg := testConfig(t)
+			cfg.OutputFormat = "json"
+			cfg.OutputIndent = tc.indent
+			cfg.RequestLoggingEnabled = true
+			stop := startRun(t, cfg)
+
+			if res := sendEvent(t, newTestEvent(t)); !cloudevents.IsACK(res) {
+				t.Fatal("Failed to send event:", res)
+			}
+			stop()
+
+			for _, want := range []string{tc.wantEvent, tc.wantRequest} {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Expected the output to contain %q, got:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+// captureLog redirects the output of the standard and global loggers to a
+// buffer for the duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	prevOut, prevFlags := log.Writer(), log.Flags()
+	log.SetOutput(buf)
+	log.SetFlags(0)
+
+	logger, err := newLogger(buf, "debug")
+	if err != nil {
+		t.Fatal("Error creating logger:", err)
+	}
+	restoreGlobals := zap.ReplaceGlobals(logger)
+
+	t.Cleanup(func() {
+		restoreGlobals()
+		log.SetOutput(prevOut)
+		log.SetFlags(prevFlags)
+	})
+	return buf
+}
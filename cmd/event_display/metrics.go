@@ -0,0 +1,309 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// HTTP path of the metrics endpoint served by the metrics server.
+const metricsPath = "/metrics"
+
+var (
+	// registry holds the metrics exposed by the metrics server.
+	registry = prometheus.NewRegistry()
+
+	eventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_received_total",
+		Help: "Number of events received, by type and source.",
+	}, []string{"type", "source"})
+
+	eventsFiltered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_filtered_total",
+		Help: "Number of events acknowledged without being displayed because of a filter, by type.",
+	}, []string{"type"})
+
+	// Counters without labels are vectors nonetheless, so that they can be
+	// reset.
+	eventsInvalid = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_invalid_total",
+		Help: "Number of events received which don't conform to the CloudEvents spec.",
+	}, nil)
+
+	eventsDuplicate = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_duplicate_total",
+		Help: "Number of events acknowledged without being displayed because they were already received.",
+	}, nil)
+
+	eventsStale = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "stale_events_total",
+		Help: "Number of events rejected because their time is older than the maximum event age.",
+	}, nil)
+
+	eventsOutOfOrder = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "out_of_order_total",
+		Help: "Number of events whose sequence isn't greater than the last one of their source.",
+	}, nil)
+
+	sequenceGaps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sequence_gap_total",
+		Help: "Number of gaps detected in the sequences of sources.",
+	}, nil)
+
+	displayErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "display_errors_total",
+		Help: "Number of times received events failed to be rendered for display.",
+	}, nil)
+
+	injectedFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "injected_failures_total",
+		Help: "Number of events rejected because of FAIL_RATE.",
+	}, nil)
+
+	schemaViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "schema_violations_total",
+		Help: "Number of events whose data violates the JSON schema of DATA_SCHEMA_FILE.",
+	}, nil)
+
+	forwardTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "forward_timeouts_total",
+		Help: "Number of times events failed to be forwarded to a sink within FORWARD_TIMEOUT.",
+	}, nil)
+
+	eventProcessing = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "event_processing_seconds",
+		Help:    "Time taken to display, archive and forward received events.",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, nil)
+
+	eventDataBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "event_data_bytes",
+		Help:    "Size of the data of received events.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, nil)
+
+	largeEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "large_events_total",
+		Help: "Number of events whose data is larger than LARGE_EVENT_BYTES.",
+	}, nil)
+
+	partitionKeysTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "partitionkeys_total",
+		Help: "Number of events received with a partitionkey extension, by key. Keys beyond the first 100 are counted as other.",
+	}, []string{"key"})
+
+	eventsRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_rate_limited_total",
+		Help: "Number of events rejected because their source exceeded its rate limit.",
+	}, nil)
+)
+
+// resettableMetrics are the metrics of the registry, which are reset by
+// resetMetrics.
+var resettableMetrics = []interface {
+	prometheus.Collector
+	Reset()
+}{
+	eventsReceived,
+	eventsFiltered,
+	eventsInvalid,
+	eventsDuplicate,
+	eventsStale,
+	eventsOutOfOrder,
+	sequenceGaps,
+	displayErrors,
+	injectedFailures,
+	schemaViolations,
+	forwardTimeouts,
+	eventProcessing,
+	eventDataBytes,
+	largeEvents,
+	partitionKeysTotal,
+	eventsRateLimited,
+}
+
+func init() {
+	for _, m := range resettableMetrics {
+		registry.MustRegister(m)
+	}
+}
+
+// resetMetrics deletes all the values of the metrics of the registry, and
+// forgets the partition keys labeling them.
+func resetMetrics() {
+	for _, m := range resettableMetrics {
+		m.Reset()
+	}
+	partitionKeys.Reset()
+}
+
+// metricsMiddleware exposes the metrics endpoint.
+func metricsMiddleware(next http.Handler) http.Handler {
+	metrics := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == metricsPath {
+			metrics.ServeHTTP(w, req)
+		} else {
+			next.ServeHTTP(w, req)
+		}
+	})
+}
+
+// HTTP path prefix of the profiling endpoints served by the metrics server.
+const pprofPathPrefix = "/debug/pprof/"
+
+// pprofMiddleware exposes the runtime profiling endpoints.
+func pprofMiddleware(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pprofPathPrefix, pprof.Index)
+	mux.HandleFunc(pprofPathPrefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(pprofPathPrefix+"profile", pprof.Profile)
+	mux.HandleFunc(pprofPathPrefix+"symbol", pprof.Symbol)
+	mux.HandleFunc(pprofPathPrefix+"trace", pprof.Trace)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, pprofPathPrefix) {
+			mux.ServeHTTP(w, req)
+		} else {
+			next.ServeHTTP(w, req)
+		}
+	})
+}
+
+// HTTP path of the endpoint resetting metrics and buffered events on the
+// metrics server.
+const resetPath = "/reset"
+
+// resetMiddleware exposes an endpoint which, on POST requests, resets the
+// metrics and the given count of received events, and clears the given
+// buffer, each if not nil.
+func resetMiddleware(received *atomic.Uint64, recent *eventBuffer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != resetPath {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		resetMetrics()
+		if received != nil {
+			received.Store(0)
+		}
+		if recent != nil {
+			recent.Reset()
+		}
+		zap.L().Info("Reset metrics and buffered events")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// metricsOptions configures the endpoints of the metrics server.
+type metricsOptions struct {
+	// Whether the runtime profiling endpoints are exposed.
+	pprofEnabled bool
+	// Whether the administration endpoints are exposed.
+	adminEnabled bool
+	// Buffer of the last received events, exposed when not nil.
+	recent *eventBuffer
+	// Hub of the clients tailing received events, exposed when not nil.
+	tail *tailHub
+	// Time of startup and number of received events, shown on the status
+	// page of the administration endpoints when received isn't nil, and
+	// reset with the metrics.
+	start    time.Time
+	received *atomic.Uint64
+}
+
+// newMetricsHandler returns the handler of the metrics server.
+func newMetricsHandler(opts metricsOptions) http.Handler {
+	h := http.NotFoundHandler()
+	if opts.pprofEnabled {
+		h = pprofMiddleware(h)
+	}
+	if opts.adminEnabled {
+		if opts.received != nil {
+			h = statusMiddleware(opts.start, opts.received, opts.recent, h)
+		}
+		h = resetMiddleware(opts.received, opts.recent, h)
+	}
+	if opts.recent != nil {
+		h = eventsMiddleware(opts.recent, h)
+	}
+	if opts.tail != nil {
+		h = tailMiddleware(opts.tail, h)
+	}
+	return metricsMiddleware(versionMiddleware(h))
+}
+
+// singlePortMiddleware serves the endpoints of the metrics server with the
+// given handler, and all other paths with the next handler, so that the
+// receiver and the metrics server share a single port.
+func singlePortMiddleware(metrics http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		mux := http.NewServeMux()
+		mux.Handle("/", next)
+		for _, path := range metricsServerPaths {
+			mux.Handle(path, metrics)
+		}
+		return mux
+	}
+}
+
+// metricsServerPaths are the paths of the metrics server, which can't be used
+// by the receiver when sharing its port.
+var metricsServerPaths = []string{metricsPath, versionPath, pprofPathPrefix, resetPath, eventsPath, tailPath}
+
+// isMetricsServerPath returns whether the given path is served by the metrics
+// server.
+func isMetricsServerPath(path string) bool {
+	for _, p := range metricsServerPaths {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// startMetricsServer serves the given handler on the given port in the
+// background. The returned server must be shut down by the caller.
+func startMetricsServer(port string, handler http.Handler) (*http.Server, error) {
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{
+		Handler: handler,
+	}
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Error("Error during metrics server's runtime", zap.Error(err))
+		}
+	}()
+	return srv, nil
+}
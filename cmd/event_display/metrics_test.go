@@ -0,0 +1,271 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+const metricsURL = "http://localhost:9090" + metricsPath
+
+func TestRun_EventsReceivedMetric(t *testing.T) {
+	startRun(t, testConfig(t))
+
+	for i := 0; i < 2; i++ {
+		event := newTestEvent(t)
+		event.SetType("dev.knative.eventing.test.metrics")
+		if res := sendEvent(t, event); !cloudevents.IsACK(res) {
+			t.Fatal("Failed to send event:", res)
+		}
+	}
+
+	const want = `events_received_total{source="https://knative.dev/eventing/cmd/heartbeats",type="dev.knative.eventing.test.metrics"} 2`
+	if metrics := scrapeMetrics(t); !strings.Contains(metrics, want) {
+		t.Errorf("Expected metrics to contain %q, got:\n%s", want, metrics)
+	}
+}
+
+func TestRun_EventProcessingMetric(t *testing.T) {
+	startRun(t, testConfig(t))
+	before := histogramCount(t, "event_processing_seconds")
+
+	for i := 0; i < 3; i++ {
+		if res := sendEvent(t, newTestEvent(t)); !cloudevents.IsACK(res) {
+			t.Fatal("Failed to send event:", res)
+		}
+	}
+
+	if got := histogramCount(t, "event_processing_seconds") - before; got != 3 {
+		t.Error("Expected 3 processed events to be observed, got", got)
+	}
+	metrics := scrapeMetrics(t)
+	for _, want := range []string{`event_processing_seconds_bucket{le="0.001"}`, `event_processing_seconds_bucket{le="10"}`, "event_processing_seconds_sum"} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestRun_EventDataMetrics(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.LargeEventBytes = 1024
+	startRun(t, cfg)
+	smallBefore := histogramBucketCount(t, "event_data_bytes", 64)
+	countBefore := histogramCount(t, "event_data_bytes")
+	largeBefore := counterValue(t, "large_events_total", nil)
+
+	large := newTestEvent(t)
+	if err := large.SetData("text/plain", strings.Repeat("x", 4096)); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range []cloudevents.Event{newTestEvent(t), large} {
+		if res := sendEvent(t, event); !cloudevents.IsACK(res) {
+			t.Fatal("Failed to send event:", res)
+		}
+	}
+
+	if got := histogramCount(t, "event_data_bytes") - countBefore; got != 2 {
+		t.Error("Expected 2 observed events, got", got)
+	}
+	if got := histogramBucketCount(t, "event_data_bytes", 64) - smallBefore; got != 1 {
+		t.Error("Expected 1 event of at most 64 bytes, got", got)
+	}
+	if got := counterValue(t, "large_events_total", nil) - largeBefore; got != 1 {
+		t.Error("Expected 1 large event, got", got)
+	}
+}
+
+func TestRun_ResetEndpoint(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.AdminEnabled = true
+	startRun(t, cfg)
+
+	receivedLabels := map[string]string{
+		"source": "https://knative.dev/eventing/cmd/heartbeats",
+		"type":   "dev.knative.eventing.samples.heartbeat",
+	}
+	for i := 0; i < 2; i++ {
+		if res := sendEvent(t, newTestEvent(t)); !cloudevents.IsACK(res) {
+			t.Fatal("Failed to send event:", res)
+		}
+	}
+
+	resp, err := http.Post("http://localhost:9090"+resetPath, "", nil)
+	if err != nil {
+		t.Fatal("Error resetting:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatal("Unexpected status code resetting:", resp.StatusCode)
+	}
+
+	if got := recentEvents(t); len(got) != 0 {
+		t.Error("Expected no buffered event after reset, got", len(got))
+	}
+	if got := counterValue(t, "events_received_total", receivedLabels); got != 0 {
+		t.Error("Expected the received events counter to be reset, got", got)
+	}
+
+	if res := sendEvent(t, newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Fatal("Failed to send event:", res)
+	}
+	if got := counterValue(t, "events_received_total", receivedLabels); got != 1 {
+		t.Error("Expected the received events counter to restart from 0, got", got)
+	}
+	if got := recentEvents(t); len(got) != 1 {
+		t.Error("Expected 1 buffered event after reset, got", len(got))
+	}
+	resp, err = http.Get("http://localhost:9090" + statusPath)
+	if err != nil {
+		t.Fatal("Error getting status page:", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("Error reading status page:", err)
+	}
+	if !strings.Contains(string(body), "<dt>Events received</dt><dd>1</dd>") {
+		t.Errorf("Expected the count of received events to restart from 0, got:\n%s", body)
+	}
+}
+
+func TestNewMetricsHandler_Reset(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		rec := httptest.NewRecorder()
+		newMetricsHandler(metricsOptions{adminEnabled: enabled}).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, resetPath, nil))
+
+		want := http.StatusNotFound
+		if enabled {
+			want = http.StatusNoContent
+		}
+		if rec.Code != want {
+			t.Errorf("With admin enabled: %t, expected status code %d, got %d", enabled, want, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	newMetricsHandler(metricsOptions{adminEnabled: true}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, resetPath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Error("Unexpected status code of a GET request:", rec.Code)
+	}
+}
+
+func TestNewMetricsHandler_Pprof(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		rec := httptest.NewRecorder()
+		newMetricsHandler(metricsOptions{pprofEnabled: enabled}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pprofPathPrefix, nil))
+
+		want := http.StatusNotFound
+		if enabled {
+			want = http.StatusOK
+		}
+		if rec.Code != want {
+			t.Errorf("With pprof enabled: %t, expected status code %d, got %d", enabled, want, rec.Code)
+		}
+	}
+}
+
+// scrapeMetrics returns the content of the metrics endpoint.
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+
+	resp, err := http.Get(metricsURL)
+	if err != nil {
+		t.Fatal("Error scraping metrics:", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("Unexpected status code scraping metrics:", resp.StatusCode)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("Error reading metrics:", err)
+	}
+	return string(b)
+}
+
+// counterValue returns the current value of the counter with the given name
+// and labels, or 0 if it wasn't incremented yet.
+func counterValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal("Error gathering metrics:", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// histogramCount returns the number of observations of the histogram with the
+// given name.
+func histogramCount(t *testing.T, name string) uint64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal("Error gathering metrics:", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+// histogramBucketCount returns the number of observations of the histogram
+// with the given name which are less than or equal to the given upper bound.
+func histogramBucketCount(t *testing.T, name string, upperBound float64) uint64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal("Error gathering metrics:", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name || len(family.GetMetric()) == 0 {
+			continue
+		}
+		for _, b := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			if b.GetUpperBound() == upperBound {
+				return b.GetCumulativeCount()
+			}
+		}
+	}
+	return 0
+}
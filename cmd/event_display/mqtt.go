@@ -0,0 +1,325 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// Events are received over MQTT 3.1.1 in the structured content mode of the
+// CloudEvents MQTT binding, the only mode this version of MQTT supports:
+// each PUBLISH payload is an event in the JSON format. Neither the binding
+// nor an MQTT client is a dependency of this module, so mqttSubscriber
+// implements the minimal subset of MQTT 3.1.1 needed to subscribe:
+//   - a single plain TCP connection, without TLS, authentication nor
+//     reconnection, with a clean session;
+//   - a single subscription, with QoS 0 or 1;
+//   - CONNECT, CONNACK, SUBSCRIBE, SUBACK, PUBLISH, PUBACK, PINGREQ, PINGRESP
+//     and DISCONNECT packets, the others being ignored.
+//
+// Packets larger than maxMQTTPacketBytes, and malformed packets, end the
+// subscription with an error.
+
+// Types of MQTT control packets, in the high nibble of their first byte.
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttSubscribe  = 8
+	mqttSuback     = 9
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+// Keep alive interval of MQTT connections, pinged at half of it. The broker
+// is considered gone when nothing is received for a whole interval.
+const mqttKeepAlive = 60 * time.Second
+
+// Maximum size of the body of received MQTT packets. The remaining length
+// of packets can be up to 256MiB, which isn't allocated for a single event.
+const maxMQTTPacketBytes = 4 << 20
+
+// mqttOptions configures the subscription to an MQTT broker.
+type mqttOptions struct {
+	// host:port of the broker.
+	broker string
+	// Topic filter of the subscription, which may contain wildcards.
+	topic    string
+	clientID string
+}
+
+// mqttBrokerAddress returns the host:port of the given MQTT broker, which
+// may be prefixed by the tcp:// or mqtt:// scheme.
+func mqttBrokerAddress(broker string) string {
+	for _, scheme := range []string{"tcp://", "mqtt://"} {
+		broker = strings.TrimPrefix(broker, scheme)
+	}
+	return broker
+}
+
+// mqttSubscriber is a connection to an MQTT broker subscribed to a topic.
+type mqttSubscriber struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// Guards writes to conn, which are made by the receive loop and the
+	// keep alive pings.
+	mu sync.Mutex
+}
+
+// subscribeMQTT connects to the broker with a clean session and subscribes to
+// the topic of opts, with QoS 1.
+func subscribeMQTT(ctx context.Context, opts mqttOptions) (*mqttSubscriber, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", mqttBrokerAddress(opts.broker))
+	if err != nil {
+		return nil, err
+	}
+	s := &mqttSubscriber{conn: conn, r: bufio.NewReader(conn)}
+	if err := s.handshake(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *mqttSubscriber) handshake(opts mqttOptions) error {
+	// Protocol name and level of MQTT 3.1.1, clean session flag, keep alive
+	// in seconds, and client identifier.
+	var connect []byte
+	connect = appendMQTTString(connect, "MQTT")
+	connect = append(connect, 4, 0x02)
+	connect = appendUint16(connect, uint16(mqttKeepAlive/time.Second))
+	connect = appendMQTTString(connect, opts.clientID)
+	if err := s.write(mqttConnect<<4, connect); err != nil {
+		return err
+	}
+	typ, _, body, err := s.read()
+	switch {
+	case err != nil:
+		return err
+	case typ != mqttConnack || len(body) != 2:
+		return fmt.Errorf("expected CONNACK, got packet of type %d", typ)
+	case body[1] != 0:
+		return fmt.Errorf("connection refused by broker, return code %d", body[1])
+	}
+
+	// Packet identifier, topic filter and requested QoS.
+	subscribe := appendUint16(nil, 1)
+	subscribe = appendMQTTString(subscribe, opts.topic)
+	subscribe = append(subscribe, 1)
+	if err := s.write(mqttSubscribe<<4|0x02, subscribe); err != nil {
+		return err
+	}
+	typ, _, body, err = s.read()
+	switch {
+	case err != nil:
+		return err
+	case typ != mqttSuback || len(body) != 3:
+		return fmt.Errorf("expected SUBACK, got packet of type %d", typ)
+	case body[2] == 0x80:
+		return fmt.Errorf("subscription to %q refused by broker", opts.topic)
+	}
+	return nil
+}
+
+// Receive passes the events published to the topic to handler, and
+// acknowledges them once handled, until ctx is cancelled. MQTT 3.1.1 has no
+// negative acknowledgement, so events rejected by handler are logged and
+// acknowledged nonetheless.
+func (s *mqttSubscriber) Receive(ctx context.Context, handler eventHandler) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ping := time.NewTicker(mqttKeepAlive / 2)
+		defer ping.Stop()
+		for {
+			select {
+			case <-ping.C:
+				if err := s.write(mqttPingreq<<4, nil); err != nil {
+					zap.L().Warn("Failed to ping MQTT broker", zap.Error(err))
+				}
+			case <-ctx.Done():
+				// Unblocks the read of the next packet.
+				_ = s.write(mqttDisconnect<<4, nil)
+				s.conn.Close()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		// Pings are answered at least once per interval.
+		_ = s.conn.SetReadDeadline(time.Now().Add(mqttKeepAlive))
+		typ, flags, body, err := s.read()
+		if err == nil && typ == mqttPublish {
+			err = s.handlePublish(ctx, flags, body, handler)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				// The connection was closed on shutdown.
+				return nil
+			}
+			return err
+		}
+		switch typ {
+		case mqttPublish, mqttPingresp:
+		default:
+			zap.L().Debug("Ignored MQTT packet", zap.Int("type", typ))
+		}
+	}
+}
+
+func (s *mqttSubscriber) handlePublish(ctx context.Context, flags byte, body []byte, handler eventHandler) error {
+	qos := flags >> 1 & 0x03
+	topic, body, err := readMQTTString(body)
+	if err != nil {
+		return err
+	}
+	var packetID []byte
+	switch qos {
+	case 0:
+	case 1:
+		if len(body) < 2 {
+			return errors.New("truncated PUBLISH packet")
+		}
+		packetID, body = body[:2], body[2:]
+	default:
+		// QoS 2 isn't granted to the subscription.
+		return fmt.Errorf("unsupported QoS %d of message published to %q", qos, topic)
+	}
+
+	var event cloudevents.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		zap.L().Error("Failed to decode event published over MQTT", zap.String("topic", topic), zap.Error(err))
+	} else if err := event.Validate(); err != nil {
+		eventsInvalid.WithLabelValues().Inc()
+		zap.L().Error("Invalid event published over MQTT", zap.String("topic", topic), zap.Error(err))
+	} else if _, res := handler(ctx, event); !cloudevents.IsACK(res) {
+		zap.L().Error("Failed to handle event published over MQTT", zap.String("id", event.ID()), zap.Error(res))
+	}
+	if packetID != nil {
+		return s.write(mqttPuback<<4, packetID)
+	}
+	return nil
+}
+
+// write sends a packet with the given first byte and body.
+func (s *mqttSubscriber) write(header byte, body []byte) error {
+	packet := append([]byte{header}, appendMQTTLength(nil, len(body))...)
+	packet = append(packet, body...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.conn.Write(packet)
+	return err
+}
+
+// read returns the type, flags and body of the next packet.
+func (s *mqttSubscriber) read() (typ int, flags byte, body []byte, err error) {
+	header, err := s.r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	// The remaining length is encoded in at most 4 bytes of 7 bits.
+	length := 0
+	for i := 0; ; i++ {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length |= int(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, 0, nil, errors.New("malformed remaining length of MQTT packet")
+		}
+	}
+	if length > maxMQTTPacketBytes {
+		return 0, 0, nil, fmt.Errorf("MQTT packet of %d bytes exceeds the maximum of %d bytes", length, maxMQTTPacketBytes)
+	}
+	body = make([]byte, length)
+	if _, err := io.ReadFull(s.r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return int(header >> 4), header & 0x0f, body, nil
+}
+
+// appendMQTTLength appends the remaining length n of a packet to b.
+func appendMQTTLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n & 0x7f)
+		if n >>= 7; n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// appendMQTTString appends the length-prefixed UTF-8 string s to b.
+func appendMQTTString(b []byte, s string) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendUint16 appends the big-endian encoding of v to b.
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// readMQTTString returns the length-prefixed string at the start of b, and the
+// rest of b.
+func readMQTTString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("truncated MQTT string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("truncated MQTT string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// serveMQTT passes the events published to the topic of opts to handler,
+// until ctx is cancelled.
+func serveMQTT(ctx context.Context, opts mqttOptions, handler eventHandler) error {
+	s, err := subscribeMQTT(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("subscribing to MQTT broker %s: %w", opts.broker, err)
+	}
+	defer s.conn.Close()
+	return s.Receive(ctx, handler)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestRun_MQTT(t *testing.T) {
+	out := captureLog(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	event := newTestEvent(t)
+	event.SetType("dev.knative.eventing.test.mqtt")
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acked := make(chan []byte, 2)
+	brokerErr := make(chan error, 1)
+	go func() {
+		brokerErr <- serveTestMQTTBroker(l, "telemetry/#", [][]byte{[]byte("not an event"), payload}, acked)
+	}()
+
+	cfg := testConfig(t)
+	cfg.Protocol = "mqtt"
+	cfg.MQTTBroker = "tcp://" + l.Addr().String()
+	cfg.MQTTTopic = "telemetry/#"
+	cfg.OutputFormat = "compact"
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx, cfg)
+	}()
+
+	for _, want := range [][]byte{{0, 1}, {0, 2}} {
+		select {
+		case got := <-acked:
+			if !bytes.Equal(got, want) {
+				t.Errorf("Expected message %v to be acknowledged, got %v", want, got)
+			}
+		case err := <-brokerErr:
+			t.Fatal("Broker failed:", err)
+		case <-ctx.Done():
+			t.Fatal("Messages weren't acknowledged")
+		}
+	}
+	cancel()
+	<-done
+
+	if !strings.Contains(out.String(), `"type": dev.knative.eventing.test.mqtt`) {
+		t.Errorf("Expected the event to be displayed, got:\n%s", out)
+	}
+	if !strings.Contains(out.String(), "Failed to decode event published over MQTT") {
+		t.Errorf("Expected the invalid message to be logged, got:\n%s", out)
+	}
+	if !strings.Contains(out.String(), "received 1 events") {
+		t.Errorf("Expected 1 received event, got:\n%s", out)
+	}
+}
+
+// serveTestMQTTBroker accepts an MQTT connection on l, expects a subscription
+// to topic, publishes the given payloads with QoS 1, and sends the packet
+// identifiers of their acknowledgements to acked.
+func serveTestMQTTBroker(l net.Listener, topic string, payloads [][]byte, acked chan<- []byte) error {
+	conn, err := l.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// The client codec reads and writes packets on the broker side too.
+	s := &mqttSubscriber{conn: conn, r: bufio.NewReader(conn)}
+
+	typ, _, body, err := s.read()
+	if err != nil {
+		return err
+	}
+	wantConnect := append([]byte{0, 4, 'M', 'Q', 'T', 'T', 4, 0x02, 0, 60, 0, 13}, "event_display"...)
+	if typ != mqttConnect || !bytes.Equal(body, wantConnect) {
+		return fmt.Errorf("unexpected CONNECT packet of type %d: %v", typ, body)
+	}
+	if _, err := conn.Write([]byte{0x20, 2, 0, 0}); err != nil {
+		return err
+	}
+
+	typ, flags, body, err := s.read()
+	if err != nil {
+		return err
+	}
+	wantSubscribe := append(append([]byte{0, 1, 0, byte(len(topic))}, topic...), 1)
+	if typ != mqttSubscribe || flags != 0x02 || !bytes.Equal(body, wantSubscribe) {
+		return fmt.Errorf("unexpected SUBSCRIBE packet of type %d: %v", typ, body)
+	}
+	if _, err := conn.Write([]byte{0x90, 3, 0, 1, 1}); err != nil {
+		return err
+	}
+
+	for i, payload := range payloads {
+		publish := append(appendMQTTString(nil, "telemetry/heartbeats"), 0, byte(i+1))
+		if err := s.write(mqttPublish<<4|0x02, append(publish, payload...)); err != nil {
+			return err
+		}
+		typ, _, body, err := s.read()
+		if err != nil {
+			return err
+		}
+		if typ != mqttPuback {
+			return fmt.Errorf("expected PUBACK, got packet of type %d", typ)
+		}
+		acked <- body
+	}
+
+	// Waits for the client to disconnect.
+	for {
+		if _, _, _, err := s.read(); err != nil {
+			return nil
+		}
+	}
+}
+
+func TestMQTTLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097152} {
+		encoded := appendMQTTLength(nil, n)
+		s := &mqttSubscriber{r: bufio.NewReader(bytes.NewReader(append(append([]byte{0x30}, encoded...), make([]byte, n)...)))}
+		if _, _, body, err := s.read(); err != nil || len(body) != n {
+			t.Errorf("Expected a body of %d bytes, got %d bytes and error %v", n, len(body), err)
+		}
+	}
+}
+
+func TestMQTTRead_Malformed(t *testing.T) {
+	for name, packet := range map[string][]byte{
+		"remaining length over 4 bytes": {0x30, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"truncated remaining length":    {0x30, 0x80},
+		"truncated body":                {0x30, 0x03, 0x00},
+		"oversized packet":              append([]byte{0x30}, appendMQTTLength(nil, maxMQTTPacketBytes+1)...),
+	} {
+		s := &mqttSubscriber{r: bufio.NewReader(bytes.NewReader(packet))}
+		if _, _, _, err := s.read(); err == nil {
+			t.Errorf("Expected an error reading a packet with %s", name)
+		}
+	}
+}
+
+func TestMQTTHandlePublish_Malformed(t *testing.T) {
+	handler := func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		t.Error("Expected no event to be handled")
+		return nil, nil
+	}
+	for name, tc := range map[string]struct {
+		flags byte
+		body  []byte
+	}{
+		"truncated topic":   {body: []byte{0x00, 0x05, 'a'}},
+		"missing packet id": {flags: 1 << 1, body: appendMQTTString(nil, "events")},
+		"unsupported QoS 2": {flags: 2 << 1, body: appendMQTTString(nil, "events")},
+	} {
+		s := &mqttSubscriber{}
+		if err := s.handlePublish(context.Background(), tc.flags, tc.body, handler); err == nil {
+			t.Errorf("Expected an error handling a PUBLISH packet with %s", name)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"knative.dev/pkg/tracing/config"
+)
+
+// With the otel tracing backend, the OpenCensus spans, such as the display
+// spans, are exported to an OpenTelemetry collector with OTLP over HTTP in
+// the JSON encoding. Neither the OpenTelemetry SDK nor an OTLP exporter is a
+// dependency of this module, and only the OpenTelemetry API is vendored, so
+// otlpExporter implements the encoding of the spans rather than bridging
+// them to an SDK. As OTLP/JSON requires, IDs are hex-encoded, and 64-bit
+// integers are decimal strings. Since spans are still recorded by
+// OpenCensus, they have the same attributes with both backends, and trace
+// context is propagated with W3C traceparent headers, like with the
+// opencensus backend.
+
+const (
+	// Interval at which spans are exported to the collector.
+	otlpExportInterval = 5 * time.Second
+	// Spans ended while this many are waiting to be exported are dropped.
+	otlpMaxQueuedSpans = 2048
+	// Timeout of each export request.
+	otlpExportTimeout = 10 * time.Second
+)
+
+// Name of the service the exported spans belong to.
+const otlpServiceName = "event_display"
+
+// validOTLPEndpoint returns whether endpoint is the http or https base URL
+// of a collector.
+func validOTLPEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// otlpExporter is an OpenCensus exporter of spans to an OTLP/HTTP endpoint.
+type otlpExporter struct {
+	logger *zap.Logger
+	// URL of the traces signal of the collector, ending in /v1/traces.
+	url    string
+	client *http.Client
+
+	mu    sync.Mutex
+	spans []*trace.SpanData
+
+	stop     chan struct{}
+	done     chan struct{}
+	shutdown sync.Once
+}
+
+// setupOTLPTracing registers an exporter of spans to the OTLP/HTTP collector
+// at endpoint, such as http://localhost:4318, and samples spans according to
+// the given JSON tracing config. Its backend and Zipkin endpoint are ignored.
+func setupOTLPTracing(logger *zap.Logger, endpoint, jsonConfig string) *otlpExporter {
+	e := &otlpExporter{
+		logger: logger,
+		url:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		client: &http.Client{Timeout: otlpExportTimeout},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	_ = e.ApplyConfig(parseTracingConfig(logger, jsonConfig))
+	trace.RegisterExporter(e)
+	go e.run()
+	return e
+}
+
+// ApplyConfig applies the sampling of the given tracing config.
+func (e *otlpExporter) ApplyConfig(conf *config.Config) error {
+	sampler := trace.ProbabilitySampler(conf.SampleRate)
+	if conf.Debug {
+		sampler = trace.AlwaysSample()
+	}
+	trace.ApplyConfig(trace.Config{DefaultSampler: sampler})
+	return nil
+}
+
+// ExportSpan queues the given span until it is exported.
+func (e *otlpExporter) ExportSpan(s *trace.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.spans) < otlpMaxQueuedSpans {
+		e.spans = append(e.spans, s)
+	}
+}
+
+// Shutdown stops the exporter once the queued spans are exported.
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	e.shutdown.Do(func() {
+		trace.UnregisterExporter(e)
+		close(e.stop)
+	})
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run exports the queued spans at every interval until the exporter is shut
+// down.
+func (e *otlpExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(otlpExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			e.flush()
+			return
+		case <-ticker.C:
+			e.flush()
+		}
+	}
+}
+
+// flush exports the queued spans, which are dropped if the collector can't
+// be reached.
+func (e *otlpExporter) flush() {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	if err := e.export(spans); err != nil {
+		e.logger.Warn("Failed to export spans", zap.String("url", e.url), zap.Int("spans", len(spans)), zap.Error(err))
+	}
+}
+
+// export sends the given spans to the collector.
+func (e *otlpExporter) export(spans []*trace.SpanData) error {
+	body, err := json.Marshal(newOTLPTraces(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Messages of the OTLP/JSON encoding, a subset of the trace service request
+// of opentelemetry-proto. IDs are hex-encoded and 64-bit integers are
+// strings.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpKeyValue struct {
+		Key string `json:"key"`
+		// Holds a single stringValue, boolValue, intValue or doubleValue.
+		Value map[string]interface{} `json:"value"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// Kinds of OTLP spans.
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpSpanKindClient   = 3
+)
+
+// Code of the status of OTLP spans which failed.
+const otlpStatusCodeError = 2
+
+// newOTLPTraces returns the export request of the given spans.
+func newOTLPTraces(spans []*trace.SpanData) otlpTraces {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		otlpSpans = append(otlpSpans, newOTLPSpan(s))
+	}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: map[string]interface{}{"stringValue": otlpServiceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: otlpServiceName},
+			Spans: otlpSpans,
+		}},
+	}}}
+}
+
+// newOTLPSpan converts the given OpenCensus span.
+func newOTLPSpan(s *trace.SpanData) otlpSpan {
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.SpanID[:]),
+		Name:              s.Name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+	}
+	if s.ParentSpanID != (trace.SpanID{}) {
+		span.ParentSpanID = hex.EncodeToString(s.ParentSpanID[:])
+	}
+	switch s.SpanKind {
+	case trace.SpanKindServer:
+		span.Kind = otlpSpanKindServer
+	case trace.SpanKindClient:
+		span.Kind = otlpSpanKindClient
+	}
+	for k, v := range s.Attributes {
+		span.Attributes = append(span.Attributes, otlpKeyValue{Key: k, Value: otlpValue(v)})
+	}
+	// Attributes are ordered for the export to be deterministic.
+	sort.Slice(span.Attributes, func(i, j int) bool { return span.Attributes[i].Key < span.Attributes[j].Key })
+	// OpenCensus spans are OK unless they have an error code.
+	if s.Code != trace.StatusCodeOK {
+		span.Status = otlpStatus{Code: otlpStatusCodeError, Message: s.Message}
+	}
+	return span
+}
+
+// otlpValue returns the OTLP value of the given OpenCensus attribute value.
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}
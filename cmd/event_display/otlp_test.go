@@ -0,0 +1,171 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+func TestRun_OTLP(t *testing.T) {
+	captureLog(t)
+	requests := make(chan otlpTraces, 16)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected export to %s of %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var traces otlpTraces
+		if err := json.NewDecoder(r.Body).Decode(&traces); err != nil {
+			t.Error("Failed to decode the exported spans:", err)
+		}
+		requests <- traces
+	}))
+	defer collector.Close()
+
+	cfg := testConfig(t)
+	cfg.TracingBackend = "otel"
+	cfg.OTLPEndpoint = collector.URL
+	cfg.ConfigTracing = `{"debug": "true"}`
+	stop := startRun(t, cfg)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodPost, ceClientURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Id", "otlp-1")
+	req.Header.Set("Ce-Type", "dev.knative.otlp")
+	req.Header.Set("Ce-Source", "/otlp")
+	req.Header.Set("Traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		t.Fatal("Expected the event to be received, got", resp.Status)
+	}
+	// Queued spans are exported on shutdown.
+	stop()
+
+	var display *otlpSpan
+	for len(requests) > 0 {
+		traces := <-requests
+		for _, rs := range traces.ResourceSpans {
+			if got := rs.Resource.Attributes; len(got) != 1 || got[0].Key != "service.name" || got[0].Value["stringValue"] != "event_display" {
+				t.Errorf("Unexpected resource attributes %v", got)
+			}
+			for _, ss := range rs.ScopeSpans {
+				for i, span := range ss.Spans {
+					if span.Name == "display" {
+						display = &ss.Spans[i]
+					}
+				}
+			}
+		}
+	}
+	if display == nil {
+		t.Fatal("Expected the display span to be exported")
+	}
+	if display.TraceID != traceID || display.ParentSpanID == "" {
+		t.Errorf("Expected the display span to be part of the propagated trace, got trace %q and parent %q", display.TraceID, display.ParentSpanID)
+	}
+	want := map[string]string{"ce.type": "dev.knative.otlp", "ce.source": "/otlp", "ce.id": "otlp-1"}
+	got := make(map[string]string)
+	for _, kv := range display.Attributes {
+		got[kv.Key], _ = kv.Value["stringValue"].(string)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected attribute %s=%q, got %q", k, v, got[k])
+		}
+	}
+}
+
+func TestNewOTLPSpan(t *testing.T) {
+	start := time.Unix(1, 500)
+	span := newOTLPSpan(&trace.SpanData{
+		SpanContext: trace.SpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}},
+		SpanKind:    trace.SpanKindClient,
+		Name:        "send",
+		StartTime:   start,
+		EndTime:     start.Add(time.Second),
+		Attributes:  map[string]interface{}{"retries": int64(2), "ok": false, "ratio": 0.5},
+		Status:      trace.Status{Code: trace.StatusCodeUnavailable, Message: "unreachable"},
+	})
+
+	if span.TraceID != "01000000000000000000000000000000" || span.SpanID != "0200000000000000" || span.ParentSpanID != "" {
+		t.Errorf("Unexpected IDs %q, %q and parent %q", span.TraceID, span.SpanID, span.ParentSpanID)
+	}
+	if span.Kind != otlpSpanKindClient {
+		t.Errorf("Expected a client span, got kind %d", span.Kind)
+	}
+	if span.StartTimeUnixNano != "1000000500" || span.EndTimeUnixNano != "2000000500" {
+		t.Errorf("Unexpected times %s and %s", span.StartTimeUnixNano, span.EndTimeUnixNano)
+	}
+	b, err := json.Marshal(span.Attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantAttributes = `[{"key":"ok","value":{"boolValue":false}},{"key":"ratio","value":{"doubleValue":0.5}},{"key":"retries","value":{"intValue":"2"}}]`
+	if string(b) != wantAttributes {
+		t.Errorf("Expected attributes %s, got %s", wantAttributes, b)
+	}
+	if span.Status != (otlpStatus{Code: otlpStatusCodeError, Message: "unreachable"}) {
+		t.Errorf("Expected an error status, got %+v", span.Status)
+	}
+}
+
+// TestNewOTLPTraces_Encoding checks the export request against the rules of
+// the OTLP/JSON encoding: lowerCamelCase field names, trace and span IDs as
+// lowercase hex rather than base64, 64-bit integers as decimal strings, and
+// enums as integers.
+func TestNewOTLPTraces_Encoding(t *testing.T) {
+	start := time.Unix(1700000000, 123)
+	traces := newOTLPTraces([]*trace.SpanData{{
+		SpanContext: trace.SpanContext{
+			TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+			SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		},
+		ParentSpanID: trace.SpanID{0xff, 0, 0, 0, 0, 0, 0, 1},
+		SpanKind:     trace.SpanKindServer,
+		Name:         "display",
+		StartTime:    start,
+		EndTime:      start.Add(time.Millisecond),
+		Attributes:   map[string]interface{}{"ce.id": "1", "size": int64(1) << 40},
+	}})
+	b, err := json.Marshal(traces)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"event_display"}}]},` +
+		`"scopeSpans":[{"scope":{"name":"event_display"},"spans":[{` +
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7","parentSpanId":"ff00000000000001",` +
+		`"name":"display","kind":2,"startTimeUnixNano":"1700000000000000123","endTimeUnixNano":"1700000000001000123",` +
+		`"attributes":[{"key":"ce.id","value":{"stringValue":"1"}},{"key":"size","value":{"intValue":"1099511627776"}}],` +
+		`"status":{}}]}]}]}`
+	if string(b) != want {
+		t.Errorf("Unexpected OTLP/JSON encoding:\nwant %s\ngot  %s", want, b)
+	}
+}
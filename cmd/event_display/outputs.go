@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// eventOutput is a destination of displayed events.
+type eventOutput struct {
+	logger   *zap.Logger
+	renderer eventRenderer
+	// Whether the binding mode of events is displayed as a line following
+	// them, in the pretty format.
+	modeLine bool
+}
+
+// parseOutputs parses a comma-separated list of format:target pairs into
+// eventOutputs. Targets are stdout, stderr, or the path of a file to which
+// events are appended. The jsonl format renders events as JSON, one per line.
+// Events are logged at the given level, and rendered with the given options.
+// The returned closers close the opened files, including on error.
+func parseOutputs(s, level string, opts renderOptions) ([]eventOutput, []io.Closer, error) {
+	var (
+		outputs []eventOutput
+		closers []io.Closer
+	)
+	for _, pair := range splitList(s) {
+		format, target, ok := strings.Cut(pair, ":")
+		if !ok || format == "" || target == "" {
+			return nil, closers, fmt.Errorf("invalid output %q, expected format:target", pair)
+		}
+
+		newOutputLogger := newLogger
+		if isMessageFormat(format) {
+			newOutputLogger = newMessageLogger
+		}
+		rendered, renderOpts := format, opts
+		if format == "jsonl" {
+			rendered = "json"
+			renderOpts.indent = ""
+		}
+		r, err := newRenderer(rendered, renderOpts)
+		if err != nil {
+			return nil, closers, err
+		}
+
+		var w io.Writer
+		switch target {
+		case "stdout", "stderr":
+			w, _ = standardStream(target)
+		default:
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+			if err != nil {
+				return nil, closers, fmt.Errorf("opening output %q: %w", pair, err)
+			}
+			closers = append(closers, f)
+			w = f
+		}
+		logger, err := newOutputLogger(w, level)
+		if err != nil {
+			return nil, closers, err
+		}
+		outputs = append(outputs, eventOutput{logger: logger, renderer: r, modeLine: format == "pretty"})
+	}
+	return outputs, closers, nil
+}
+
+// isMessageFormat returns whether events displayed in the given format are
+// logged as bare messages, without level prefix nor fields, so that the output
+// is made of complete JSON or YAML documents and CSV rows.
+func isMessageFormat(format string) bool {
+	switch format {
+	case "json", "jsonl", "yaml", "ndjson", "csv":
+		return true
+	}
+	return false
+}
+
+// displayHeaders displays the header of the outputs whose renderer has one.
+func displayHeaders(outputs []eventOutput) {
+	for _, o := range outputs {
+		if r, ok := o.renderer.(headerRenderer); ok {
+			o.logger.Info(r.Header())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDisplayOutputs(t *testing.T) {
+	dir := t.TempDir()
+	prettyPath := filepath.Join(dir, "events.log")
+	jsonlPath := filepath.Join(dir, "events.jsonl")
+
+	outputs, closers, err := parseOutputs("pretty:"+prettyPath+", jsonl:"+jsonlPath, "info", renderOptions{})
+	if err != nil {
+		t.Fatal("Error parsing outputs:", err)
+	}
+	event := newTestEvent(t)
+	displayOutputs(outputs, false)(context.Background(), event)
+	closeAll(closers)
+
+	pretty, err := os.ReadFile(prettyPath)
+	if err != nil {
+		t.Fatal("Error reading pretty output:", err)
+	}
+	if want := render(t, prettyRenderer{}, event); !strings.Contains(string(pretty), want) {
+		t.Errorf("Expected the pretty output to contain:\n%s\ngot:\n%s", want, pretty)
+	}
+
+	jsonl, err := os.ReadFile(jsonlPath)
+	if err != nil {
+		t.Fatal("Error reading JSONL output:", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(jsonl), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line of JSONL output, got:\n%s", jsonl)
+	}
+	got := cloudevents.NewEvent()
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("Expected a JSON CloudEvent: %v\n%s", err, lines[0])
+	}
+	if diff := cmp.Diff(event.String(), got.String()); diff != "" {
+		t.Error("Unexpected event (-want, +got):", diff)
+	}
+}
+
+func TestParseOutputs_Invalid(t *testing.T) {
+	for _, outputs := range []string{
+		"pretty",
+		"xml:stdout",
+		":stdout",
+		"json:" + filepath.Join(t.TempDir(), "missing", "events.jsonl"),
+	} {
+		_, closers, err := parseOutputs(outputs, "info", renderOptions{})
+		closeAll(closers)
+		if err == nil {
+			t.Errorf("Expected an error for outputs %q", outputs)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Name of the extension holding the partitioning key of events, as set by
+// Kafka-backed brokers.
+const partitionKeyExtension = "partitionkey"
+
+// partitionKey returns the partitioning key of the given event, and whether
+// it has one.
+func partitionKey(event cloudevents.Event) (string, bool) {
+	v, ok := event.Extensions()[partitionKeyExtension]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// Maximum number of partition keys with their own label in the metrics, and
+// label of the others.
+const (
+	maxPartitionKeyLabels = 100
+	otherPartitionKeys    = "other"
+)
+
+// partitionKeyLabels caps the number of distinct partition keys used as
+// labels, so that events with unique keys don't explode the cardinality of
+// the metrics. It is safe for concurrent use.
+type partitionKeyLabels struct {
+	mu   sync.Mutex
+	max  int
+	keys map[string]bool
+}
+
+func newPartitionKeyLabels(max int) *partitionKeyLabels {
+	return &partitionKeyLabels{
+		max:  max,
+		keys: make(map[string]bool),
+	}
+}
+
+// Label returns the label of the given key: the key itself if it is one of
+// the first max keys, and otherPartitionKeys otherwise.
+func (l *partitionKeyLabels) Label(key string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.keys[key] {
+		if len(l.keys) >= l.max {
+			return otherPartitionKeys
+		}
+		l.keys[key] = true
+	}
+	return key
+}
+
+// Reset forgets the keys seen so far, so that the next max keys get their own
+// label.
+func (l *partitionKeyLabels) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.keys = make(map[string]bool)
+}
+
+// partitionKeys labels the partition keys counted by partitionKeysTotal.
+var partitionKeys = newPartitionKeyLabels(maxPartitionKeyLabels)
+
+// countPartitionKey counts the given event by partition key, if it has one.
+func countPartitionKey(event cloudevents.Event) {
+	if key, ok := partitionKey(event); ok {
+		partitionKeysTotal.WithLabelValues(partitionKeys.Label(key)).Inc()
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestPartitionKeyLabels(t *testing.T) {
+	l := newPartitionKeyLabels(2)
+	for _, tc := range []struct{ key, want string }{
+		{"a", "a"},
+		{"b", "b"},
+		{"c", otherPartitionKeys},
+		// Keys seen before the cap was reached keep their own label.
+		{"a", "a"},
+		{"d", otherPartitionKeys},
+	} {
+		if got := l.Label(tc.key); got != tc.want {
+			t.Errorf("Expected label %q for key %q, got %q", tc.want, tc.key, got)
+		}
+	}
+}
+
+func TestPartitionKeyLabels_Reset(t *testing.T) {
+	l := newPartitionKeyLabels(1)
+	l.Label("a")
+	l.Reset()
+	if got := l.Label("b"); got != "b" {
+		t.Errorf("Expected a new key to get its own label after a reset, got %q", got)
+	}
+}
+
+func TestDisplay_PartitionKey(t *testing.T) {
+	out := captureLog(t)
+	event := newTestEvent(t)
+	event.SetExtension("partitionkey", "orders-0")
+	display(zap.L(), compactRenderer{})(context.Background(), event)
+
+	if !strings.Contains(out.String(), `"partitionkey": "orders-0"`) {
+		t.Errorf("Expected the partition key to be logged with the event, got:\n%s", out)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// sourceRateLimiter limits the rate of events accepted from each source. Only
+// the most recently seen sources are tracked, to bound memory usage. It is
+// safe for concurrent use.
+type sourceRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	limiters *simplelru.LRU
+}
+
+// newSourceRateLimiter returns a sourceRateLimiter accepting up to perSecond
+// events per second from each of at most maxSources sources.
+func newSourceRateLimiter(perSecond float64, maxSources int) (*sourceRateLimiter, error) {
+	limiters, err := simplelru.NewLRU(maxSources, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceRateLimiter{
+		limit:    rate.Limit(perSecond),
+		burst:    int(math.Max(1, math.Ceil(perSecond))),
+		limiters: limiters,
+	}, nil
+}
+
+// Allow returns whether an event from the given source can be accepted now.
+func (l *sourceRateLimiter) Allow(source string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, ok := l.limiters.Get(source)
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.limiters.Add(source, limiter)
+	}
+	return limiter.(*rate.Limiter).Allow()
+}
+
+// rateLimitEvents returns an eventHandler which rejects events with a 429 when
+// their source exceeds the rate allowed by the given limiter, and passes the
+// others to next.
+func rateLimitEvents(limiter *sourceRateLimiter, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if !limiter.Allow(event.Source()) {
+			zap.L().Debug("Rate limited event", zap.String("source", event.Source()), zap.String("id", event.ID()))
+			// Sources aren't labels, as any number of them can be rate
+			// limited.
+			eventsRateLimited.WithLabelValues().Inc()
+			return nil, cehttp.NewResult(http.StatusTooManyRequests, "rate limit exceeded for source %q", event.Source())
+		}
+		return next(ctx, event)
+	}
+}
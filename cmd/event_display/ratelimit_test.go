@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.uber.org/zap"
+)
+
+func TestRateLimitEvents(t *testing.T) {
+	const burstingSource = "/bursting"
+	const otherSource = "/other"
+
+	limiter, err := newSourceRateLimiter(2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	captureLog(t)
+	handler := rateLimitEvents(limiter, display(zap.L(), compactRenderer{}))
+	limitedBefore := counterValue(t, "events_rate_limited_total", nil)
+
+	send := func(source string) cloudevents.Result {
+		event := newTestEvent(t)
+		event.SetSource(source)
+		_, res := handler(context.Background(), event)
+		return res
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := send(burstingSource); !cloudevents.IsACK(res) {
+			t.Fatalf("Expected event %d within the burst to be accepted, got: %v", i, res)
+		}
+	}
+
+	res := send(burstingSource)
+	var httpResult *cehttp.Result
+	if !cloudevents.ResultAs(res, &httpResult) || httpResult.StatusCode != http.StatusTooManyRequests {
+		t.Error("Expected event exceeding the rate limit to be rejected with a 429, got:", res)
+	}
+	if got := counterValue(t, "events_rate_limited_total", nil) - limitedBefore; got != 1 {
+		t.Error("Expected 1 rate limited event to be counted, got", got)
+	}
+
+	if res := send(otherSource); !cloudevents.IsACK(res) {
+		t.Error("Expected event from another source to be accepted, got:", res)
+	}
+}
+
+func TestSourceRateLimiter_BoundedSources(t *testing.T) {
+	limiter, err := newSourceRateLimiter(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{"/a", "/b", "/c"} {
+		limiter.Allow(source)
+	}
+
+	if got := limiter.limiters.Len(); got != 2 {
+		t.Error("Expected 2 tracked sources, got", got)
+	}
+	// The least recently seen source was evicted, and gets a fresh limiter.
+	if !limiter.Allow("/a") {
+		t.Error("Expected evicted source to be allowed again")
+	}
+}
@@ -0,0 +1,528 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// eventRenderer formats an Event for display. An error is returned when the
+// Event can't be formatted.
+type eventRenderer interface {
+	Render(cloudevents.Event) (string, error)
+}
+
+// headerRenderer is an eventRenderer whose output starts with a header,
+// displayed once before any Event.
+type headerRenderer interface {
+	eventRenderer
+	Header() string
+}
+
+// renderOptions configures how events are rendered.
+type renderOptions struct {
+	// Names of the extensions rendered. All extensions are rendered when nil,
+	// and none when empty.
+	extensions []string
+	// Location in which the time of events is displayed by the pretty format.
+	// The time is displayed as received when nil.
+	location *time.Location
+	// Whether JSON data is displayed by the pretty format as received, rather
+	// than decoded with sorted keys.
+	rawData bool
+	// Indent of events displayed by the json format, on a single line when
+	// empty.
+	indent string
+	// Whether events following another of the same type are displayed as a
+	// diff of their data.
+	diff bool
+}
+
+// newRenderer returns the eventRenderer matching the given output format.
+func newRenderer(format string, opts renderOptions) (eventRenderer, error) {
+	var r eventRenderer
+	if opts.diff && format == "csv" {
+		return nil, errors.New("the csv format can't be displayed as diffs")
+	}
+	switch format {
+	case "pretty":
+		r = prettyRenderer{location: opts.location, rawData: opts.rawData}
+	case "compact":
+		if opts.extensions != nil && len(opts.extensions) == 0 {
+			// Skips marshaling extensions, rather than removing them from a
+			// copy of each event.
+			r = compactRenderer{noExtensions: true}
+			opts.extensions = nil
+			break
+		}
+		r = compactRenderer{}
+	case "json":
+		r = jsonRenderer{indent: opts.indent}
+	case "yaml":
+		r = yamlRenderer{}
+	case "ndjson":
+		r = ndjsonRenderer{}
+	case "csv":
+		// Rows have no column for extensions.
+		return csvRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+
+	if opts.extensions != nil {
+		r = newExtensionsRenderer(opts.extensions, r)
+	}
+	if opts.diff {
+		r = newDiffRenderer(r)
+	}
+	return r, nil
+}
+
+// parseIndent parses an indent of JSON output: a number of spaces, "tab", or
+// "compact" for single-line output, returned as an empty indent.
+func parseIndent(s string) (string, error) {
+	switch s {
+	case "compact":
+		return "", nil
+	case "tab":
+		return "\t", nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("invalid indent %q, expected a number of spaces, tab or compact", s)
+	}
+	return strings.Repeat(" ", n), nil
+}
+
+// marshalJSON returns the JSON encoding of v, indented with the given indent,
+// or on a single line when it is empty.
+func marshalJSON(v interface{}, indent string) ([]byte, error) {
+	if indent == "" {
+		return json.Marshal(v)
+	}
+	return json.MarshalIndent(v, "", indent)
+}
+
+// parseDisplayedExtensions parses a comma-separated list of extension names
+// into the extensions of renderOptions. "all" selects all extensions, and
+// "none" no extension.
+func parseDisplayedExtensions(s string) []string {
+	switch s {
+	case "all":
+		return nil
+	case "none":
+		return []string{}
+	default:
+		return append([]string{}, splitList(s)...)
+	}
+}
+
+// extensionsRenderer renders events with only a selection of their
+// extensions.
+type extensionsRenderer struct {
+	names map[string]bool
+	next  eventRenderer
+}
+
+func newExtensionsRenderer(names []string, next eventRenderer) extensionsRenderer {
+	r := extensionsRenderer{
+		names: make(map[string]bool, len(names)),
+		next:  next,
+	}
+	for _, name := range names {
+		// Extension names are case-insensitive and stored lowercase.
+		r.names[strings.ToLower(name)] = true
+	}
+	return r
+}
+
+func (r extensionsRenderer) Render(event cloudevents.Event) (string, error) {
+	selected := event.Clone()
+	for name := range event.Extensions() {
+		if !r.names[name] {
+			selected.SetExtension(name, nil)
+		}
+	}
+	return r.next.Render(selected)
+}
+
+// prettyRenderer renders an Event in the human-readable format shown in the
+// example output of main.go.
+type prettyRenderer struct {
+	// Location in which the time is displayed, if not nil.
+	location *time.Location
+	// Whether JSON data is displayed as received.
+	rawData bool
+}
+
+func (r prettyRenderer) Render(event cloudevents.Event) (string, error) {
+	b := getBuffer()
+	defer putBuffer(b)
+
+	b.WriteString("☁️  cloudevents.Event\n")
+	if err := event.Validate(); err != nil {
+		fmt.Fprintf(b, "Validation: invalid\nValidation Error: \n%s\n", err)
+	} else {
+		b.WriteString("Validation: valid\n")
+	}
+
+	b.WriteString("Context Attributes,\n")
+	fmt.Fprintf(b, "  specversion: %s\n", event.SpecVersion())
+	fmt.Fprintf(b, "  type: %s\n", event.Type())
+	fmt.Fprintf(b, "  source: %s\n", event.Source())
+	if subject := event.Subject(); subject != "" {
+		fmt.Fprintf(b, "  subject: %s\n", subject)
+	}
+	fmt.Fprintf(b, "  id: %s\n", event.ID())
+	if t := event.Time(); !t.IsZero() {
+		if r.location != nil {
+			t = t.In(r.location)
+		}
+		fmt.Fprintf(b, "  time: %s\n", t.Format(time.RFC3339Nano))
+	}
+	if schema := event.DataSchema(); schema != "" {
+		fmt.Fprintf(b, "  dataschema: %s\n", schema)
+	}
+	if contentType := event.DataContentType(); contentType != "" {
+		fmt.Fprintf(b, "  datacontenttype: %s\n", contentType)
+	}
+
+	if extensions := event.Extensions(); len(extensions) > 0 {
+		b.WriteString("Extensions,\n")
+		names := make([]string, 0, len(extensions))
+		for name := range extensions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(b, "  %s: %v\n", name, extensions[name])
+		}
+	}
+
+	if data := event.Data(); len(data) > 0 {
+		b.WriteString("Data,\n")
+		for _, line := range strings.Split(formatData(event.DataContentType(), data, r.rawData), "\n") {
+			b.WriteString("  ")
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	} else {
+		b.WriteString("Data: (none)\n")
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// Maximum number of bytes shown for data of an unknown content type.
+const maxDataPreviewBytes = 256
+
+// formatData formats event data for display according to its content type.
+// JSON is decoded and displayed with sorted keys, or only indented when raw is
+// set, XML is indented, text is shown as is, and binary content is
+// base64-encoded. Data of an unknown content type is previewed as a hex dump.
+func formatData(contentType string, data []byte, raw bool) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+
+	switch {
+	case isJSONMediaType(mediaType):
+		if !raw {
+			if decoded, err := decodeJSON(data); err == nil {
+				return decoded
+			}
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err == nil {
+			return indented.String()
+		}
+		return string(data)
+
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		if indented, err := indentXML(data); err == nil {
+			return string(indented)
+		}
+		return string(data)
+
+	case strings.HasPrefix(mediaType, "text/"):
+		return strings.TrimSuffix(string(data), "\n")
+
+	case isBinaryMediaType(mediaType):
+		return fmt.Sprintf("(binary, %d bytes)\n%s", len(data), base64.StdEncoding.EncodeToString(data))
+
+	default:
+		preview := data
+		if len(preview) > maxDataPreviewBytes {
+			preview = preview[:maxDataPreviewBytes]
+		}
+		out := fmt.Sprintf("(%s, %d bytes)\n%s", mediaType, len(data), strings.TrimSuffix(hex.Dump(preview), "\n"))
+		if len(data) > len(preview) {
+			out += fmt.Sprintf("\n...[%d more bytes]", len(data)-len(preview))
+		}
+		return out
+	}
+}
+
+// decodeJSON returns the given JSON document indented, with the keys of its
+// objects sorted. Numbers are kept as received.
+func decodeJSON(data []byte) (string, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+	if _, err := d.Token(); !errors.Is(err, io.EOF) {
+		return "", errors.New("trailing data after JSON value")
+	}
+
+	b := getBuffer()
+	defer putBuffer(b)
+	e := json.NewEncoder(b)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "  ")
+	// Maps are encoded with sorted keys.
+	if err := e.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// isJSONMediaType returns whether the given media type denotes JSON data. A
+// missing media type defaults to JSON, as per the CloudEvents spec.
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "" || mediaType == "application/json" || mediaType == "text/json" ||
+		strings.HasSuffix(mediaType, "+json")
+}
+
+// isBinaryMediaType returns whether the given media type denotes binary data.
+func isBinaryMediaType(mediaType string) bool {
+	switch mediaType {
+	case "application/octet-stream",
+		"application/protobuf",
+		"application/x-protobuf",
+		"application/vnd.google.protobuf",
+		"application/avro",
+		"application/cbor":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+proto") ||
+		strings.HasPrefix(mediaType, "image/") ||
+		strings.HasPrefix(mediaType, "audio/") ||
+		strings.HasPrefix(mediaType, "video/")
+}
+
+// indentXML returns the given XML document indented.
+func indentXML(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	d := xml.NewDecoder(bytes.NewReader(data))
+	e := xml.NewEncoder(&b)
+	e.Indent("", "  ")
+
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Whitespace between elements is replaced by the encoder's indentation.
+		if cd, ok := tok.(xml.CharData); ok && len(bytes.TrimSpace(cd)) == 0 {
+			continue
+		}
+		if err := e.EncodeToken(tok); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// compactRenderer renders the data, type and extensions of an Event on a
+// single line. Missing data is rendered as null.
+type compactRenderer struct {
+	// Whether extensions are rendered as null, without being marshaled.
+	noExtensions bool
+}
+
+func (r compactRenderer) Render(event cloudevents.Event) (string, error) {
+	jsonstr := []byte("null")
+	if !r.noExtensions {
+		var err error
+		if jsonstr, err = json.Marshal(event.Context.GetExtensions()); err != nil {
+			return "", fmt.Errorf("failed to marshal extensions: %w", err)
+		}
+	}
+	b := getBuffer()
+	defer putBuffer(b)
+	b.WriteString(`{"data": `)
+	if data := event.DataEncoded; len(data) > 0 {
+		b.Write(data)
+	} else {
+		b.WriteString("null")
+	}
+	b.WriteString(`, "type": `)
+	b.WriteString(event.Context.GetType())
+	b.WriteString(`, "extensions": `)
+	b.Write(jsonstr)
+	b.WriteByte('}')
+	return b.String(), nil
+}
+
+// jsonRenderer renders an Event as a single JSON object, including all of its
+// context attributes.
+type jsonRenderer struct {
+	// Indent of the object, on a single line when empty.
+	indent string
+}
+
+func (r jsonRenderer) Render(event cloudevents.Event) (string, error) {
+	b, err := marshalJSON(event, r.indent)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return string(b), nil
+}
+
+// yamlRenderer renders an Event as a YAML document, including all of its
+// context attributes.
+type yamlRenderer struct{}
+
+func (yamlRenderer) Render(event cloudevents.Event) (string, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal event: %w", err)
+	}
+	y, err := yaml.JSONToYAML(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert event to YAML: %w", err)
+	}
+	return "---\n" + string(y), nil
+}
+
+// ndjsonRenderer renders an Event as a single-line JSON object, with its
+// context attributes and extensions flattened into top-level keys prefixed by
+// "ce_", and its data under the "data" key, null for events without data.
+// This suits log pipelines parsing newline-delimited JSON better than the
+// CloudEvents JSON envelope.
+type ndjsonRenderer struct{}
+
+func (ndjsonRenderer) Render(event cloudevents.Event) (string, error) {
+	obj := map[string]interface{}{
+		"ce_specversion": event.SpecVersion(),
+		"ce_type":        event.Type(),
+		"ce_source":      event.Source(),
+		"ce_id":          event.ID(),
+	}
+	if subject := event.Subject(); subject != "" {
+		obj["ce_subject"] = subject
+	}
+	if t := event.Time(); !t.IsZero() {
+		obj["ce_time"] = t.Format(time.RFC3339Nano)
+	}
+	if schema := event.DataSchema(); schema != "" {
+		obj["ce_dataschema"] = schema
+	}
+	if contentType := event.DataContentType(); contentType != "" {
+		obj["ce_datacontenttype"] = contentType
+	}
+	for name, value := range event.Extensions() {
+		obj["ce_"+name] = value
+	}
+
+	if data := event.Data(); len(data) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(event.DataContentType())
+		switch {
+		case isJSONMediaType(mediaType) && json.Valid(data):
+			obj["data"] = json.RawMessage(data)
+		case utf8.Valid(data):
+			obj["data"] = string(data)
+		default:
+			// Marshaled as base64.
+			obj["data"] = data
+		}
+	} else {
+		obj["data"] = nil
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return string(b), nil
+}
+
+// csvRenderer renders an Event as a CSV row of the columns of csvHeader, as
+// per RFC 4180. Data which isn't valid UTF-8 is base64-encoded.
+type csvRenderer struct{}
+
+// Columns of the rows rendered by csvRenderer.
+var csvHeader = []string{"time", "source", "type", "id", "datacontenttype", "data"}
+
+func (csvRenderer) Header() string {
+	// Can't fail, the header is a valid record.
+	row, _ := formatCSV(csvHeader)
+	return row
+}
+
+func (csvRenderer) Render(event cloudevents.Event) (string, error) {
+	var t string
+	if !event.Time().IsZero() {
+		t = event.Time().Format(time.RFC3339Nano)
+	}
+	data := event.Data()
+	encoded := string(data)
+	if !utf8.Valid(data) {
+		encoded = base64.StdEncoding.EncodeToString(data)
+	}
+	return formatCSV([]string{t, event.Source(), event.Type(), event.ID(), event.DataContentType(), encoded})
+}
+
+// formatCSV formats the given record as a CSV row, without line ending.
+func formatCSV(record []string) (string, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if err := w.Write(record); err != nil {
+		return "", err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
@@ -0,0 +1,506 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+)
+
+func TestPrettyRenderer(t *testing.T) {
+	event := newTestEvent(t)
+	event.SetExtension("heart", "yes")
+
+	const want = `☁️  cloudevents.Event
+Validation: valid
+Context Attributes,
+  specversion: 1.0
+  type: dev.knative.eventing.samples.heartbeat
+  source: https://knative.dev/eventing/cmd/heartbeats
+  id: 2b72d7bf-c38f-4a98-a433-608fbcdd2596
+  time: 2019-10-18T15:23:20Z
+  datacontenttype: application/json
+Extensions,
+  beats: true
+  heart: yes
+Data,
+  {
+    "id": 2,
+    "label": ""
+  }`
+
+	if diff := cmp.Diff(want, render(t, prettyRenderer{}, event)); diff != "" {
+		t.Error("Unexpected output (-want, +got):", diff)
+	}
+}
+
+func TestPrettyRenderer_NoData(t *testing.T) {
+	event := newTestEvent(t)
+	event.DataEncoded = nil
+	event.SetDataContentType("")
+
+	const want = `☁️  cloudevents.Event
+Validation: valid
+Context Attributes,
+  specversion: 1.0
+  type: dev.knative.eventing.samples.heartbeat
+  source: https://knative.dev/eventing/cmd/heartbeats
+  id: 2b72d7bf-c38f-4a98-a433-608fbcdd2596
+  time: 2019-10-18T15:23:20Z
+Extensions,
+  beats: true
+Data: (none)`
+
+	if diff := cmp.Diff(want, render(t, prettyRenderer{}, event)); diff != "" {
+		t.Error("Unexpected output (-want, +got):", diff)
+	}
+}
+
+func TestPrettyRendererInvalidEvent(t *testing.T) {
+	event := newTestEvent(t)
+	event.SetSource("")
+
+	out := render(t, prettyRenderer{}, event)
+	if !strings.Contains(out, "Validation: invalid") || !strings.Contains(out, "source") {
+		t.Errorf("Expected the output to report the missing source, got:\n%s", out)
+	}
+}
+
+func TestPrettyRendererLocation(t *testing.T) {
+	event := newTestEvent(t)
+	location, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skip("Time zone database unavailable:", err)
+	}
+
+	out := render(t, prettyRenderer{location: location}, event)
+
+	if want := "  time: 2019-10-18T12:23:20-03:00\n"; !strings.Contains(out, want) {
+		t.Errorf("Expected the output to contain %q, got:\n%s", want, out)
+	}
+	if got := event.Time(); !got.Equal(time.Date(2019, 10, 18, 15, 23, 20, 0, time.UTC)) || got.Location() != time.UTC {
+		t.Error("Expected the event time to be left unchanged, got:", got)
+	}
+}
+
+func TestFormatData(t *testing.T) {
+	testCases := map[string]struct {
+		contentType string
+		data        []byte
+		want        string
+	}{
+		"JSON": {
+			contentType: "application/json",
+			data:        []byte(`{"id":2,"label":"a"}`),
+			want:        "{\n  \"id\": 2,\n  \"label\": \"a\"\n}",
+		},
+		"structured JSON suffix with parameters": {
+			contentType: "application/cloudevents+json; charset=utf-8",
+			data:        []byte(`[1,2]`),
+			want:        "[\n  1,\n  2\n]",
+		},
+		"invalid JSON": {
+			contentType: "application/json",
+			data:        []byte(`{"id":`),
+			want:        `{"id":`,
+		},
+		"XML": {
+			contentType: "application/xml",
+			data:        []byte(`<order id="2"><item>  book </item><qty>1</qty></order>`),
+			want:        "<order id=\"2\">\n  <item>  book </item>\n  <qty>1</qty>\n</order>",
+		},
+		"plain text": {
+			contentType: "text/plain",
+			data:        []byte("hello,\nworld\n"),
+			want:        "hello,\nworld",
+		},
+		"protobuf": {
+			contentType: "application/protobuf",
+			data:        []byte{0x08, 0x96, 0x01, 0x12, 0x02, 'h', 'i'},
+			want:        "(binary, 7 bytes)\nCJYBEgJoaQ==",
+		},
+		"unknown": {
+			contentType: "application/x-custom",
+			data:        []byte("\x00\x01abc"),
+			want:        "(application/x-custom, 5 bytes)\n00000000  00 01 61 62 63                                    |..abc|",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, formatData(tc.contentType, tc.data, false)); diff != "" {
+				t.Error("Unexpected output (-want, +got):", diff)
+			}
+		})
+	}
+}
+
+func TestFormatData_JSONKeyOrder(t *testing.T) {
+	data := []byte(`{"zone":"b","id":12345678901234567890,"nested":{"y":[{"b":1,"a":"<2>"}],"x":null}}`)
+
+	const want = `{
+  "id": 12345678901234567890,
+  "nested": {
+    "x": null,
+    "y": [
+      {
+        "a": "<2>",
+        "b": 1
+      }
+    ]
+  },
+  "zone": "b"
+}`
+	if diff := cmp.Diff(want, formatData("application/json", data, false)); diff != "" {
+		t.Error("Unexpected decoded output (-want, +got):", diff)
+	}
+
+	const wantRaw = `{
+  "zone": "b",
+  "id": 12345678901234567890,
+  "nested": {
+    "y": [
+      {
+        "b": 1,
+        "a": "<2>"
+      }
+    ],
+    "x": null
+  }
+}`
+	if diff := cmp.Diff(wantRaw, formatData("application/json", data, true)); diff != "" {
+		t.Error("Unexpected raw output (-want, +got):", diff)
+	}
+}
+
+func TestFormatData_UnknownPreviewIsTruncated(t *testing.T) {
+	data := bytes.Repeat([]byte{0xff}, maxDataPreviewBytes+10)
+
+	out := formatData("application/x-custom", data, false)
+
+	if !strings.HasSuffix(out, "...[10 more bytes]") {
+		t.Errorf("Expected the preview to be truncated, got:\n%s", out)
+	}
+}
+
+func TestCompactRenderer(t *testing.T) {
+	event := newTestEvent(t)
+
+	const want = `{"data": {"id":2,"label":""}, "type": dev.knative.eventing.samples.heartbeat, "extensions": {"beats":true}}`
+	if got := render(t, compactRenderer{}, event); got != want {
+		t.Errorf("Unexpected output, want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestCompactRenderer_NoData(t *testing.T) {
+	event := newTestEvent(t)
+	event.DataEncoded = nil
+	event.SetDataContentType("")
+
+	const want = `{"data": null, "type": dev.knative.eventing.samples.heartbeat, "extensions": {"beats":true}}`
+	if got := render(t, compactRenderer{}, event); got != want {
+		t.Errorf("Unexpected output, want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestJSONRenderer(t *testing.T) {
+	event := newTestEvent(t)
+
+	out := render(t, jsonRenderer{}, event)
+
+	got := cloudevents.NewEvent()
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("Output is not a valid JSON CloudEvent: %v\n%s", err, out)
+	}
+	if diff := cmp.Diff(event.String(), got.String()); diff != "" {
+		t.Error("Unexpected event (-want, +got):", diff)
+	}
+}
+
+func TestYAMLRenderer(t *testing.T) {
+	event := newTestEvent(t)
+
+	out := render(t, yamlRenderer{}, event)
+
+	doc := strings.TrimPrefix(out, "---\n")
+	if doc == out {
+		t.Fatalf("Expected the output to start with a YAML document separator, got:\n%s", out)
+	}
+	b, err := yaml.YAMLToJSON([]byte(doc))
+	if err != nil {
+		t.Fatalf("Output is not valid YAML: %v\n%s", err, out)
+	}
+	got := cloudevents.NewEvent()
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Output is not a valid CloudEvent: %v\n%s", err, out)
+	}
+	if diff := cmp.Diff(event.String(), got.String()); diff != "" {
+		t.Error("Unexpected event (-want, +got):", diff)
+	}
+}
+
+func TestNDJSONRenderer(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := newMessageLogger(&out, "info")
+	if err != nil {
+		t.Fatal("Error creating logger:", err)
+	}
+	handler := display(logger, ndjsonRenderer{})
+
+	heartbeat := newTestEvent(t)
+	text := newTestEvent(t)
+	text.SetID("2")
+	text.SetSubject("greeting")
+	if err := text.SetData("text/plain", "hello,\nworld"); err != nil {
+		t.Fatal(err)
+	}
+	handler(context.Background(), heartbeat)
+	handler(context.Background(), text)
+
+	want := []map[string]interface{}{{
+		"ce_specversion":     "1.0",
+		"ce_type":            "dev.knative.eventing.samples.heartbeat",
+		"ce_source":          "https://knative.dev/eventing/cmd/heartbeats",
+		"ce_id":              "2b72d7bf-c38f-4a98-a433-608fbcdd2596",
+		"ce_time":            "2019-10-18T15:23:20Z",
+		"ce_datacontenttype": "application/json",
+		"ce_beats":           true,
+		"data":               map[string]interface{}{"id": float64(2), "label": ""},
+	}, {
+		"ce_specversion":     "1.0",
+		"ce_type":            "dev.knative.eventing.samples.heartbeat",
+		"ce_source":          "https://knative.dev/eventing/cmd/heartbeats",
+		"ce_id":              "2",
+		"ce_subject":         "greeting",
+		"ce_time":            "2019-10-18T15:23:20Z",
+		"ce_datacontenttype": "text/plain",
+		"ce_beats":           true,
+		"data":               "hello,\nworld",
+	}}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d lines, got:\n%s", len(want), out.String())
+	}
+	for i, line := range lines {
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("Line %d is not a JSON object: %v\n%s", i, err, line)
+		}
+		if diff := cmp.Diff(want[i], got); diff != "" {
+			t.Errorf("Unexpected object on line %d (-want, +got): %s", i, diff)
+		}
+	}
+}
+
+func TestNDJSONRenderer_NoData(t *testing.T) {
+	event := newTestEvent(t)
+	event.DataEncoded = nil
+	event.SetDataContentType("")
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(render(t, ndjsonRenderer{}, event)), &got); err != nil {
+		t.Fatal("Output is not a JSON object:", err)
+	}
+	if data, ok := got["data"]; !ok || data != nil {
+		t.Errorf("Got data %v (present: %t), want null", data, ok)
+	}
+}
+
+func TestCSVRenderer(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := newMessageLogger(&out, "info")
+	if err != nil {
+		t.Fatal("Error creating logger:", err)
+	}
+	outputs := []eventOutput{{logger: logger, renderer: csvRenderer{}}}
+	displayHeaders(outputs)
+	handler := displayOutputs(outputs, false)
+
+	heartbeat := newTestEvent(t)
+	text := newTestEvent(t)
+	text.SetID("2")
+	if err := text.SetData("text/plain", "hello, \"world\"\nbye"); err != nil {
+		t.Fatal(err)
+	}
+	handler(context.Background(), heartbeat)
+	handler(context.Background(), text)
+
+	got, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("Output is not valid CSV: %v\n%s", err, out.String())
+	}
+	want := [][]string{
+		{"time", "source", "type", "id", "datacontenttype", "data"},
+		{"2019-10-18T15:23:20Z", heartbeat.Source(), heartbeat.Type(), heartbeat.ID(), "application/json", `{"id":2,"label":""}`},
+		{"2019-10-18T15:23:20Z", text.Source(), text.Type(), "2", "text/plain", "hello, \"world\"\nbye"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("Unexpected records (-want, +got):", diff)
+	}
+}
+
+func TestNewRenderer(t *testing.T) {
+	for _, format := range []string{"pretty", "compact", "json", "yaml", "ndjson", "csv"} {
+		if _, err := newRenderer(format, renderOptions{}); err != nil {
+			t.Errorf("Unexpected error for format %q: %v", format, err)
+		}
+	}
+	if _, err := newRenderer("xml", renderOptions{}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestNewRenderer_Extensions(t *testing.T) {
+	event := newTestEvent(t)
+	event.SetExtension("heart", "yes")
+	event.SetExtension("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	testCases := map[string]struct {
+		selection string
+		want      string
+	}{
+		"all": {
+			selection: "all",
+			want:      `{"beats":true,"heart":"yes","traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`,
+		},
+		"allowlist of one": {
+			selection: "Heart",
+			want:      `{"heart":"yes"}`,
+		},
+		"none": {
+			selection: "none",
+			want:      `null`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r, err := newRenderer("compact", renderOptions{extensions: parseDisplayedExtensions(tc.selection)})
+			if err != nil {
+				t.Fatal("Error creating renderer:", err)
+			}
+
+			want := `{"data": {"id":2,"label":""}, "type": dev.knative.eventing.samples.heartbeat, "extensions": ` + tc.want + `}`
+			if got := render(t, r, event); got != want {
+				t.Errorf("Unexpected output, want:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+
+	if len(event.Extensions()) != 3 {
+		t.Error("Expected the rendered event to be left unchanged, got extensions:", event.Extensions())
+	}
+}
+
+func BenchmarkDisplay_Formats(b *testing.B) {
+	logger, err := newLogger(io.Discard, "info")
+	if err != nil {
+		b.Fatal("Error creating logger:", err)
+	}
+	event := cloudevents.NewEvent()
+	event.SetID("2b72d7bf-c38f-4a98-a433-608fbcdd2596")
+	event.SetType("dev.knative.eventing.samples.heartbeat")
+	event.SetSource("https://knative.dev/eventing/cmd/heartbeats")
+	event.SetExtension("beats", true)
+	if err := event.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"id": 2, "label": ""}); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, format := range []string{"pretty", "compact"} {
+		b.Run(format, func(b *testing.B) {
+			r, err := newRenderer(format, renderOptions{})
+			if err != nil {
+				b.Fatal("Error creating renderer:", err)
+			}
+			handler := display(logger, r)
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				handler(ctx, event)
+			}
+		})
+	}
+}
+
+func BenchmarkDisplay_Extensions(b *testing.B) {
+	logger, err := newLogger(io.Discard, "info")
+	if err != nil {
+		b.Fatal("Error creating logger:", err)
+	}
+	event := cloudevents.NewEvent()
+	event.SetID("2b72d7bf-c38f-4a98-a433-608fbcdd2596")
+	event.SetType("dev.knative.eventing.samples.heartbeat")
+	event.SetSource("https://knative.dev/eventing/cmd/heartbeats")
+	event.SetExtension("beats", true)
+	event.SetExtension("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err := event.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"id": 2, "label": ""}); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, selection := range []string{"all", "none"} {
+		b.Run(selection, func(b *testing.B) {
+			r, err := newRenderer("compact", renderOptions{extensions: parseDisplayedExtensions(selection)})
+			if err != nil {
+				b.Fatal("Error creating renderer:", err)
+			}
+			handler := display(logger, r)
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				handler(ctx, event)
+			}
+		})
+	}
+}
+
+// render renders the given Event, failing the test on error.
+func render(t *testing.T, r eventRenderer, event cloudevents.Event) string {
+	t.Helper()
+	out, err := r.Render(event)
+	if err != nil {
+		t.Fatal("Error rendering event:", err)
+	}
+	return out
+}
+
+// newTestEvent returns a valid Event with JSON data and an extension.
+func newTestEvent(t *testing.T) cloudevents.Event {
+	t.Helper()
+	event := cloudevents.NewEvent()
+	event.SetID("2b72d7bf-c38f-4a98-a433-608fbcdd2596")
+	event.SetType("dev.knative.eventing.samples.heartbeat")
+	event.SetSource("https://knative.dev/eventing/cmd/heartbeats")
+	event.SetTime(time.Date(2019, 10, 18, 15, 23, 20, 0, time.UTC))
+	event.SetExtension("beats", true)
+	if err := event.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"id": 2, "label": ""}); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cloudevents/sdk-go/observability/opencensus/v2/client"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// runReplay sends the events archived in the configured replay file to the
+// sink, at the configured rate.
+func runReplay(ctx context.Context, logger *zap.Logger, cfg Config) {
+	if cfg.Sink == "" {
+		logger.Fatal("K_SINK is required to replay events")
+	}
+
+	f, err := os.Open(cfg.ReplayFile)
+	if err != nil {
+		logger.Fatal("Failed to open replay file", zap.Error(err))
+	}
+	defer f.Close()
+
+	sender, err := client.NewClientHTTP([]cehttp.Option{cloudevents.WithTarget(cfg.Sink)}, nil)
+	if err != nil {
+		logger.Fatal("Failed to create client", zap.Error(err))
+	}
+
+	sent, err := replayEvents(ctx, sender, f, rate.NewLimiter(rate.Limit(cfg.ReplayRate), 1))
+	logger.Info("Replayed events", zap.Int("sent", sent), zap.String("sink", cfg.Sink))
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Fatal("Failed to replay events", zap.Error(err))
+	}
+}
+
+// replayEvents sends the events read from r, one JSON object each, in order
+// and at the rate allowed by limiter. It returns the number of events which
+// were successfully sent. Events failing to be sent are logged and skipped.
+func replayEvents(ctx context.Context, sender cloudevents.Client, r io.Reader, limiter *rate.Limiter) (int, error) {
+	var sent int
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		event := cloudevents.NewEvent()
+		if err := dec.Decode(&event); errors.Is(err, io.EOF) {
+			return sent, nil
+		} else if err != nil {
+			return sent, fmt.Errorf("decoding event %d: %w", n, err)
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return sent, err
+		}
+		if res := sender.Send(ctx, event); !cloudevents.IsACK(res) {
+			zap.L().Error("Failed to send event", zap.String("id", event.ID()), zap.Error(res))
+			continue
+		}
+		sent++
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"golang.org/x/time/rate"
+)
+
+func TestRun_Replay(t *testing.T) {
+	received := make(chan cloudevents.Event, 3)
+	sink := newTestSink(t, http.StatusAccepted, received)
+
+	first, second := newTestEvent(t), newTestEvent(t)
+	first.SetID("1")
+	second.SetID("2")
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, []byte(render(t, jsonRenderer{}, first)+"\n"+render(t, jsonRenderer{}, second)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(t)
+	cfg.ReplayFile = path
+	cfg.ReplayRate = 1000
+	cfg.Sink = sink.URL
+	captureLog(t)
+	run(context.Background(), cfg)
+
+	close(received)
+	var ids []string
+	for event := range received {
+		ids = append(ids, event.ID())
+	}
+	if got := strings.Join(ids, ","); got != "1,2" {
+		t.Errorf("Expected events 1,2 to be replayed in order, got: %s", got)
+	}
+}
+
+func TestReplayEvents_InvalidLine(t *testing.T) {
+	sink := newTestSink(t, http.StatusAccepted, nil)
+	r := strings.NewReader(render(t, jsonRenderer{}, newTestEvent(t)) + "\nnot json\n")
+
+	sent, err := replayEvents(context.Background(), newTestSender(t, sink.URL), r, rate.NewLimiter(rate.Inf, 1))
+	if err == nil {
+		t.Error("Expected an error decoding an invalid line")
+	}
+	if sent != 1 {
+		t.Error("Expected the events before the invalid line to be sent, got", sent)
+	}
+}
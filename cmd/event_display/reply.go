@@ -0,0 +1,45 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+)
+
+// replyWithEvent returns an eventHandler which replies to each event handled
+// by next with a copy of that event. The copy gets a new id and time so it
+// can't be mistaken for a duplicate, and is given the type replyType when set.
+func replyWithEvent(replyType string, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		reply, result := next(ctx, event)
+		if reply != nil || !cloudevents.IsACK(result) {
+			return reply, result
+		}
+
+		echo := event.Clone()
+		echo.SetID(uuid.NewString())
+		echo.SetTime(time.Now())
+		if replyType != "" {
+			echo.SetType(replyType)
+		}
+		return &echo, result
+	}
+}
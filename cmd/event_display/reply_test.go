@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRun_Reply(t *testing.T) {
+	const replyType = "dev.knative.eventing.test.reply"
+
+	cfg := testConfig(t)
+	cfg.ReplyEnabled = true
+	cfg.ReplyType = replyType
+	startRun(t, cfg)
+
+	event := newTestEvent(t)
+	req, err := http.NewRequest(http.MethodPost, ceClientURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cehttp.WriteRequest(context.Background(), binding.ToMessage(&event), req); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error sending event:", err)
+	}
+	defer resp.Body.Close()
+
+	reply, err := cehttp.NewEventFromHTTPResponse(resp)
+	if err != nil {
+		t.Fatal("Response doesn't contain a CloudEvent:", err)
+	}
+	if err := reply.Validate(); err != nil {
+		t.Error("Reply is not a valid CloudEvent:", err)
+	}
+	if reply.Type() != replyType {
+		t.Errorf("Expected reply type %q, got %q", replyType, reply.Type())
+	}
+	if reply.ID() == event.ID() {
+		t.Error("Expected the reply to have a new id, got:", reply.ID())
+	}
+	if !reply.Time().After(event.Time()) {
+		t.Error("Expected the reply to have a new time, got:", reply.Time())
+	}
+	if diff := cmp.Diff(event.Data(), reply.Data()); diff != "" {
+		t.Error("Unexpected reply data (-want, +got):", diff)
+	}
+}
+
+func TestReplyWithEvent_NoReplyOnNACK(t *testing.T) {
+	nack := func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		return nil, cehttp.NewResult(http.StatusBadRequest, "rejected")
+	}
+
+	reply, res := replyWithEvent("", nack)(context.Background(), newTestEvent(t))
+	if reply != nil {
+		t.Error("Expected no reply, got:", reply)
+	}
+	if cloudevents.IsACK(res) {
+		t.Error("Expected the result to be passed through, got:", res)
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Header of the ID correlating the log lines of a request, read from requests
+// and set on responses.
+const requestIDHeader = "X-Request-Id"
+
+// requestIDKey is the context key of the ID of the handled request.
+type requestIDKey struct{}
+
+// requestIDMiddleware is a cehttp.Middleware which adds the ID of each request
+// to its context, and to its response. The ID is read from the X-Request-Id
+// header, or generated when missing.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if id == "" {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestIDFields returns the log field of the ID of the request handled with
+// ctx, if any.
+func requestIDFields(ctx context.Context) []zap.Field {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	if !ok {
+		return nil
+	}
+	return []zap.Field{zap.String("requestID", id)}
+}
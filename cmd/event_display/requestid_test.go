@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var got []string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, f := range requestIDFields(req.Context()) {
+			got = append(got, f.String)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if len(got) != 1 || got[0] != "req-1" {
+		t.Error("Expected the request ID to be read from the header, got:", got)
+	}
+	if id := rec.Header().Get(requestIDHeader); id != "req-1" {
+		t.Error("Expected the request ID to be set on the response, got:", id)
+	}
+
+	got = nil
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if len(got) != 1 || got[0] == "" || got[0] != rec.Header().Get(requestIDHeader) {
+		t.Errorf("Expected a request ID to be generated and set on the response, got %v and %q", got, rec.Header().Get(requestIDHeader))
+	}
+}
+
+func TestRun_RequestID(t *testing.T) {
+	out := captureLog(t)
+	cfg := testConfig(t)
+	cfg.AccessLog = true
+	cfg.OutputFormat = "compact"
+	stop := startRun(t, cfg)
+
+	sender, err := cloudevents.NewClientHTTP(cloudevents.WithTarget(ceClientURL), cehttp.WithHeader(requestIDHeader, "req-42"))
+	if err != nil {
+		t.Fatal("Error creating CloudEvents client:", err)
+	}
+	if res := sender.Send(context.Background(), newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Fatal("Failed to send event:", res)
+	}
+	stop()
+
+	var accessLogged, displayed bool
+	for _, line := range strings.Split(out.String(), "\n") {
+		if !strings.Contains(line, `"requestID": "req-42"`) {
+			continue
+		}
+		accessLogged = accessLogged || strings.Contains(line, "Handled request")
+		displayed = displayed || strings.Contains(line, `"type": dev.knative.eventing.samples.heartbeat`)
+	}
+	if !accessLogged || !displayed {
+		t.Errorf("Expected the request ID in the access log and the display of the event, got:\n%s", out)
+	}
+}
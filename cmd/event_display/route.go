@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"go.uber.org/zap"
+)
+
+// typeRouter appends events to one file per type, named events-<type>.jsonl
+// in a directory, one JSON object per line. Only the files of the most
+// recently routed types are kept open, to bound the number of file
+// descriptors. It is safe for concurrent use.
+type typeRouter struct {
+	dir string
+
+	mu    sync.Mutex
+	files *simplelru.LRU
+}
+
+// newTypeRouter returns a typeRouter writing to the given directory, and
+// keeping at most maxFiles files open.
+func newTypeRouter(dir string, maxFiles int) (*typeRouter, error) {
+	files, err := simplelru.NewLRU(maxFiles, func(_, f interface{}) {
+		if err := f.(*os.File).Close(); err != nil {
+			zap.L().Error("Failed to close routed events file", zap.Error(err))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &typeRouter{dir: dir, files: files}, nil
+}
+
+// routedFileName returns the name of the file of events of the given type.
+// Characters which aren't safe in file names are replaced with underscores.
+func routedFileName(eventType string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, eventType)
+	return "events-" + safe + ".jsonl"
+}
+
+// Append writes the given event to the file of its type, opening it if
+// necessary.
+func (r *typeRouter) Append(event cloudevents.Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := routedFileName(event.Type())
+	var f *os.File
+	if v, ok := r.files.Get(name); ok {
+		f = v.(*os.File)
+	} else {
+		if f, err = os.OpenFile(filepath.Join(r.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666); err != nil {
+			return err
+		}
+		r.files.Add(name, f)
+	}
+	_, err = f.Write(b)
+	return err
+}
+
+// Close closes the open files.
+func (r *typeRouter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.files.Purge()
+	return nil
+}
+
+// routeEvents returns an eventHandler which appends each event to the file of
+// its type before passing it to next. Routing failures don't fail the receive.
+func routeEvents(router *typeRouter, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if err := router.Append(event); err != nil {
+			zap.L().Error("Failed to route event", zap.String("id", event.ID()), zap.Error(err))
+		}
+		return next(ctx, event)
+	}
+}
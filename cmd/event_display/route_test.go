@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+func TestRouteEvents(t *testing.T) {
+	dir := t.TempDir()
+	// A single open file, so that routing evicts and reopens files.
+	router, err := newTypeRouter(dir, 1)
+	if err != nil {
+		t.Fatal("Error creating router:", err)
+	}
+
+	captureLog(t)
+	handler := routeEvents(router, display(zap.L(), compactRenderer{}))
+
+	heartbeat := newTestEvent(t)
+	order := newTestEvent(t)
+	order.SetType("com.example/order created")
+	for _, event := range []cloudevents.Event{heartbeat, order, heartbeat} {
+		if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+			t.Fatal("Expected event to be acknowledged, got:", res)
+		}
+	}
+	if err := router.Close(); err != nil {
+		t.Fatal("Error closing router:", err)
+	}
+
+	for name, want := range map[string][]cloudevents.Event{
+		"events-dev.knative.eventing.samples.heartbeat.jsonl": {heartbeat, heartbeat},
+		"events-com.example_order_created.jsonl":              {order},
+	} {
+		got := readEventLines(t, filepath.Join(dir, name))
+		if diff := cmp.Diff(eventStrings(want), eventStrings(got)); diff != "" {
+			t.Errorf("Unexpected events in %s (-want, +got): %s", name, diff)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Expected one file per type, got %d files", len(entries))
+	}
+}
+
+// readEventLines reads the events of the JSON lines file at path.
+func readEventLines(t *testing.T, path string) []cloudevents.Event {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal("Error opening file:", err)
+	}
+	defer f.Close()
+
+	var events []cloudevents.Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		event := cloudevents.NewEvent()
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid line in %s: %v", path, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// eventStrings returns the string representations of the given events.
+func eventStrings(events []cloudevents.Event) []string {
+	s := make([]string, 0, len(events))
+	for _, event := range events {
+		s = append(s, event.String())
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"path"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// isSampled returns whether the event with the given id is displayed at the
+// given sample rate, between 0 and 1. Sampling is deterministic: redelivered
+// events are sampled alike.
+func isSampled(id string, rate float64) bool {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return float64(h.Sum64()) < rate*math.MaxUint64
+}
+
+// isAlwaysDisplayed returns whether the given event type matches one of the
+// given glob patterns, such as *.error.*, of types displayed regardless of
+// sampling.
+func isAlwaysDisplayed(typ string, patterns []string) bool {
+	for _, pattern := range patterns {
+		// Patterns are validated with the config.
+		if ok, _ := path.Match(pattern, typ); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// passesSampling returns whether the given event is displayed at the given
+// sample rate, or regardless of sampling because of its type.
+func passesSampling(event cloudevents.Event, rate float64, alwaysTypes []string) bool {
+	return isSampled(event.ID(), rate) || isAlwaysDisplayed(event.Type(), alwaysTypes)
+}
+
+// sampleEvents returns an eventHandler which passes only the given fraction of
+// events to next, and all the events whose type matches one of the given
+// patterns. Other events are acknowledged without being displayed, but are
+// counted as received nonetheless.
+func sampleEvents(rate float64, alwaysTypes []string, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if !passesSampling(event, rate, alwaysTypes) {
+			eventsReceived.WithLabelValues(event.Type(), event.Source()).Inc()
+			return nil, nil
+		}
+		return next(ctx, event)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestSampleEvents(t *testing.T) {
+	const events = 1000
+	event := newTestEvent(t)
+	labels := map[string]string{"type": event.Type(), "source": event.Source()}
+	receivedBefore := counterValue(t, "events_received_total", labels)
+
+	var displayed int
+	handler := sampleEvents(0.1, nil, func(_ context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		// Displaying counts sampled events.
+		eventsReceived.WithLabelValues(event.Type(), event.Source()).Inc()
+		displayed++
+		return nil, nil
+	})
+	for i := 0; i < events; i++ {
+		event.SetID(strconv.Itoa(i))
+		if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+			t.Fatal("Expected event to be acknowledged, got:", res)
+		}
+	}
+
+	if displayed < 70 || displayed > 130 {
+		t.Errorf("Expected about 10%% of %d events to be displayed, got %d", events, displayed)
+	}
+	if got := counterValue(t, "events_received_total", labels) - receivedBefore; got != events {
+		t.Errorf("Expected all %d events to be counted as received, got %v", events, got)
+	}
+}
+
+func TestIsSampled_Deterministic(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		id := strconv.Itoa(i)
+		if isSampled(id, 0.5) != isSampled(id, 0.5) {
+			t.Fatalf("Expected event %s to be sampled alike", id)
+		}
+		if !isSampled(id, 1) {
+			t.Errorf("Expected event %s to be sampled at rate 1", id)
+		}
+	}
+}
+
+func TestSampleEvents_AlwaysDisplayType(t *testing.T) {
+	const events = 1000
+	displayed := map[string]int{}
+	handler := sampleEvents(0.1, []string{"*.error.*", "dev.knative.fatal"}, func(_ context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		displayed[event.Type()]++
+		return nil, nil
+	})
+	for _, typ := range []string{"dev.knative.error.v1", "dev.knative.fatal", "dev.knative.heartbeat"} {
+		event := newTestEvent(t)
+		event.SetType(typ)
+		for i := 0; i < events; i++ {
+			event.SetID(strconv.Itoa(i))
+			if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+				t.Fatal("Expected event to be acknowledged, got:", res)
+			}
+		}
+	}
+
+	for _, typ := range []string{"dev.knative.error.v1", "dev.knative.fatal"} {
+		if got := displayed[typ]; got != events {
+			t.Errorf("Expected all %d events of type %s to be displayed, got %d", events, typ, got)
+		}
+	}
+	if got := displayed["dev.knative.heartbeat"]; got < 70 || got > 130 {
+		t.Errorf("Expected about 10%% of %d other events to be displayed, got %d", events, got)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// Timeout of the requests fetching data schemas.
+const schemaFetchTimeout = 5 * time.Second
+
+// schemaFetcher fetches the data schemas of events, and caches them by URI.
+// Only schemas fetched successfully are cached. It is safe for concurrent use.
+type schemaFetcher struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	schemas map[string]json.RawMessage
+}
+
+// newSchemaFetcher returns a schemaFetcher fetching schemas with the given
+// client.
+func newSchemaFetcher(client *http.Client) *schemaFetcher {
+	return &schemaFetcher{
+		client:  client,
+		schemas: make(map[string]json.RawMessage),
+	}
+}
+
+// Fetch returns the JSON schema at the given URI, from the cache if it was
+// already fetched.
+func (f *schemaFetcher) Fetch(ctx context.Context, uri string) (json.RawMessage, error) {
+	f.mu.Lock()
+	schema, ok := f.schemas[uri]
+	f.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, schemaFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(b) {
+		return nil, fmt.Errorf("schema isn't valid JSON")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schemas[uri] = b
+	return b, nil
+}
+
+// fetchSchemas returns an eventHandler which fetches the data schema of each
+// event before passing it to next. Fetch failures are logged, but don't fail
+// the receive. Data isn't validated against the schemas, no JSON Schema
+// validator is a dependency of this module.
+func fetchSchemas(f *schemaFetcher, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if uri := event.DataSchema(); uri != "" {
+			if _, err := f.Fetch(ctx, uri); err != nil {
+				zap.L().Warn("Failed to fetch data schema", zap.String("id", event.ID()), zap.String("dataschema", uri), zap.Error(err))
+			}
+		}
+		return next(ctx, event)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/atomic"
+)
+
+func TestFetchSchemas(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fetches.Inc()
+		if req.URL.Path != "/schema.json" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write([]byte(`{"type": "object"}`))
+	}))
+	defer server.Close()
+
+	var handled int
+	handler := fetchSchemas(newSchemaFetcher(server.Client()), func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		handled++
+		return nil, nil
+	})
+	event := newTestEvent(t)
+	event.SetDataSchema(server.URL + "/schema.json")
+	for i := 0; i < 2; i++ {
+		if _, res := handler(context.Background(), event); res != nil {
+			t.Fatalf("Got result %v, want nil", res)
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("Got %d schema fetches, want 1", got)
+	}
+
+	// Failures are logged, and retried on the next event.
+	buf := captureLog(t)
+	event.SetDataSchema(server.URL + "/missing.json")
+	if _, res := handler(context.Background(), event); res != nil {
+		t.Fatalf("Got result %v, want nil", res)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("Got %d schema fetches, want 2", got)
+	}
+	if !strings.Contains(buf.String(), "Failed to fetch data schema") {
+		t.Errorf("Missing fetch failure in log:\n%s", buf)
+	}
+	if handled != 3 {
+		t.Errorf("Handled %d events, want 3", handled)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"go.uber.org/zap"
+)
+
+// Name of the extension holding the position of events in the sequence of
+// their source.
+const sequenceExtension = "sequence"
+
+// sequenceChecker tracks the last sequence number of each source, to detect
+// events received out of order or after a gap. Only the most recently seen
+// sources are tracked, to bound memory usage. It is safe for concurrent use.
+type sequenceChecker struct {
+	mu   sync.Mutex
+	last *simplelru.LRU
+}
+
+// newSequenceChecker returns a sequenceChecker tracking at most maxSources
+// sources.
+func newSequenceChecker(maxSources int) (*sequenceChecker, error) {
+	last, err := simplelru.NewLRU(maxSources, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sequenceChecker{last: last}, nil
+}
+
+// Check records the given sequence number of the given source. It returns
+// whether the number isn't greater than the last one of the source, and how
+// many numbers are missing since the last one otherwise. The first number of
+// a source is always in order.
+func (c *sequenceChecker) Check(source string, seq uint64) (outOfOrder bool, missing uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.last.Get(source)
+	if !ok {
+		c.last.Add(source, seq)
+		return false, 0
+	}
+	last := v.(uint64)
+	if seq <= last {
+		return true, 0
+	}
+	c.last.Add(source, seq)
+	return false, seq - last - 1
+}
+
+// checkSequences returns an eventHandler which logs warnings about events
+// whose sequence extension is out of order or follows a gap, before passing
+// them to next. Events without a numeric sequence are passed unchecked.
+func checkSequences(c *sequenceChecker, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		value, ok := event.Extensions()[sequenceExtension]
+		if !ok {
+			return next(ctx, event)
+		}
+		seq, err := strconv.ParseUint(fmt.Sprint(value), 10, 64)
+		if err != nil {
+			zap.L().Debug("Ignored non-numeric sequence", zap.String("id", event.ID()), zap.Any("sequence", value))
+			return next(ctx, event)
+		}
+
+		switch outOfOrder, missing := c.Check(event.Source(), seq); {
+		case outOfOrder:
+			zap.L().Warn("Received event out of order", zap.String("source", event.Source()),
+				zap.String("id", event.ID()), zap.Uint64("sequence", seq))
+			eventsOutOfOrder.WithLabelValues().Inc()
+		case missing > 0:
+			zap.L().Warn("Received event after a sequence gap", zap.String("source", event.Source()),
+				zap.String("id", event.ID()), zap.Uint64("sequence", seq), zap.Uint64("missing", missing))
+			sequenceGaps.WithLabelValues().Inc()
+		}
+		return next(ctx, event)
+	}
+}
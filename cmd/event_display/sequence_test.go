@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestCheckSequences(t *testing.T) {
+	testCases := map[string]struct {
+		sequences      []interface{}
+		wantOutOfOrder float64
+		wantGaps       float64
+	}{
+		"in order": {
+			sequences: []interface{}{"1", "2", int32(3), "4"},
+		},
+		"out of order": {
+			sequences:      []interface{}{"1", "3", "2", "4"},
+			wantOutOfOrder: 1,
+			wantGaps:       1,
+		},
+		"redelivered": {
+			sequences:      []interface{}{"1", "2", "2"},
+			wantOutOfOrder: 1,
+		},
+		"gaps": {
+			sequences: []interface{}{"1", "4", "5", "7"},
+			wantGaps:  2,
+		},
+		"non-numeric": {
+			sequences: []interface{}{"1", "two", "-3", "2"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			checker, err := newSequenceChecker(10)
+			if err != nil {
+				t.Fatal("Error creating sequence checker:", err)
+			}
+			passed := 0
+			handler := checkSequences(checker, func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+				passed++
+				return nil, nil
+			})
+			outOfOrderBefore := counterValue(t, "out_of_order_total", nil)
+			gapsBefore := counterValue(t, "sequence_gap_total", nil)
+			captureLog(t)
+
+			for _, seq := range tc.sequences {
+				event := newTestEvent(t)
+				event.SetExtension(sequenceExtension, seq)
+				if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+					t.Error("Expected event to be acknowledged, got:", res)
+				}
+			}
+
+			if passed != len(tc.sequences) {
+				t.Errorf("Expected all %d events to be passed, got %d", len(tc.sequences), passed)
+			}
+			if got := counterValue(t, "out_of_order_total", nil) - outOfOrderBefore; got != tc.wantOutOfOrder {
+				t.Errorf("Expected %v events out of order, got %v", tc.wantOutOfOrder, got)
+			}
+			if got := counterValue(t, "sequence_gap_total", nil) - gapsBefore; got != tc.wantGaps {
+				t.Errorf("Expected %v sequence gaps, got %v", tc.wantGaps, got)
+			}
+		})
+	}
+}
+
+func TestSequenceChecker_PerSource(t *testing.T) {
+	checker, err := newSequenceChecker(10)
+	if err != nil {
+		t.Fatal("Error creating sequence checker:", err)
+	}
+
+	checker.Check("a", 5)
+	if outOfOrder, missing := checker.Check("b", 1); outOfOrder || missing != 0 {
+		t.Errorf("Expected the first event of another source to be in order, got out of order: %t, missing: %d", outOfOrder, missing)
+	}
+	if outOfOrder, missing := checker.Check("a", 6); outOfOrder || missing != 0 {
+		t.Errorf("Expected the next event of the first source to be in order, got out of order: %t, missing: %d", outOfOrder, missing)
+	}
+}
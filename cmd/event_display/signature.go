@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// HTTP header carrying the hex-encoded HMAC-SHA256 signature of the request
+// body.
+const signatureHeader = "X-Signature"
+
+// signatureMiddleware returns a cehttp.Middleware which rejects with a 401 the
+// requests whose body isn't signed with the given secret. All requests are
+// passed through when the secret is empty.
+func signatureMiddleware(secret []byte) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(secret) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				zap.L().Error("Failed to read request body", zap.Error(err))
+			}
+			_ = req.Body.Close()
+			// Replace the body with a new reader after reading from the original
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			if !validSignature(secret, body, req.Header.Get(signatureHeader)) {
+				zap.L().Warn("Rejected request with an invalid signature", zap.String("remoteAddr", req.RemoteAddr))
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// validSignature returns whether signature is the hex-encoded HMAC-SHA256 of
+// body with the given secret.
+func validSignature(secret, body []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
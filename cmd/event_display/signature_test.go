@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignatureMiddleware(t *testing.T) {
+	const secret = "s3cr3t"
+	const body = `{"id":2}`
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	valid := hex.EncodeToString(mac.Sum(nil))
+
+	testCases := map[string]struct {
+		secret      string
+		signature   string
+		wantStatus  int
+		wantHandled bool
+	}{
+		"valid signature": {
+			secret:      secret,
+			signature:   valid,
+			wantStatus:  http.StatusOK,
+			wantHandled: true,
+		},
+		"invalid signature": {
+			secret:     secret,
+			signature:  strings.Repeat("0", len(valid)),
+			wantStatus: http.StatusUnauthorized,
+		},
+		"missing header": {
+			secret:     secret,
+			wantStatus: http.StatusUnauthorized,
+		},
+		"no secret": {
+			wantStatus:  http.StatusOK,
+			wantHandled: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			captureLog(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			if tc.signature != "" {
+				req.Header.Set(signatureHeader, tc.signature)
+			}
+
+			var handled bool
+			rec := httptest.NewRecorder()
+			signatureMiddleware([]byte(tc.secret))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				handled = true
+				if b, _ := io.ReadAll(req.Body); string(b) != body {
+					t.Errorf("Expected the body to be passed through, got %q", b)
+				}
+			})).ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if handled != tc.wantHandled {
+				t.Errorf("Expected request to be handled: %t, got: %t", tc.wantHandled, handled)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// sinkProber periodically checks whether sinks are reachable. It is safe for
+// concurrent use.
+type sinkProber struct {
+	client    *http.Client
+	sinks     []string
+	reachable atomic.Bool
+}
+
+// newSinkProber returns a sinkProber of the given sinks, whose probes are sent
+// with the given transport and time out after the given duration.
+func newSinkProber(sinks []string, timeout time.Duration, transport http.RoundTripper) *sinkProber {
+	return &sinkProber{
+		client: &http.Client{Transport: transport, Timeout: timeout},
+		sinks:  sinks,
+	}
+}
+
+// Reachable returns whether at least one sink was reachable at the last probe.
+// Sinks are unreachable until probed.
+func (p *sinkProber) Reachable() bool {
+	return p.reachable.Load()
+}
+
+// Probe sends a HEAD request to each sink, and records whether at least one
+// of them responded. Any response counts, since sinks aren't required to
+// handle HEAD requests.
+func (p *sinkProber) Probe(ctx context.Context) bool {
+	reachable := false
+	for _, sink := range p.sinks {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, sink, nil)
+		if err != nil {
+			zap.L().Warn("Failed to create sink probe", zap.String("sink", sink), zap.Error(err))
+			continue
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			zap.L().Warn("Sink is unreachable", zap.String("sink", sink), zap.Error(err))
+			continue
+		}
+		_ = resp.Body.Close()
+		reachable = true
+	}
+	p.reachable.Store(reachable)
+	return reachable
+}
+
+// Run probes the sinks immediately, then at every interval until ctx is
+// cancelled.
+func (p *sinkProber) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.Probe(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSinkProber(t *testing.T) {
+	sink := newTestSink(t, http.StatusAccepted, nil)
+	prober := newSinkProber([]string{sink.URL}, time.Second, http.DefaultTransport)
+	handler := readyzMiddleware(prober.Reachable)(http.NotFoundHandler())
+	probe := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, readyzPath, nil))
+		return rec.Code
+	}
+	captureLog(t)
+
+	if got := probe(); got != http.StatusServiceUnavailable {
+		t.Error("Unexpected readiness status code before probing the sink:", got)
+	}
+
+	if !prober.Probe(context.Background()) {
+		t.Error("Expected the sink to be reachable")
+	}
+	if got := probe(); got != http.StatusNoContent {
+		t.Error("Unexpected readiness status code while the sink is up:", got)
+	}
+
+	sink.Close()
+	if prober.Probe(context.Background()) {
+		t.Error("Expected the sink to be unreachable")
+	}
+	if got := probe(); got != http.StatusServiceUnavailable {
+		t.Error("Unexpected readiness status code while the sink is down:", got)
+	}
+}
+
+func TestSinkProber_Timeout(t *testing.T) {
+	hung := make(chan struct{})
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hung:
+		case <-r.Context().Done():
+		}
+	}))
+	defer sink.Close()
+	defer close(hung)
+	captureLog(t)
+
+	prober := newSinkProber([]string{sink.URL}, 10*time.Millisecond, http.DefaultTransport)
+	start := time.Now()
+	if prober.Probe(context.Background()) {
+		t.Error("Expected a sink which doesn't respond to be unreachable")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("Expected the probe to time out, it took", elapsed)
+	}
+}
+
+func TestSinkProber_InsecureSkipVerify(t *testing.T) {
+	sink := httptest.NewTLSServer(http.NotFoundHandler())
+	defer sink.Close()
+	captureLog(t)
+
+	for _, insecure := range []bool{false, true} {
+		prober := newSinkProber([]string{sink.URL}, time.Second, newForwardTransport(insecure, nil))
+		if got := prober.Probe(context.Background()); got != insecure {
+			t.Errorf("With FORWARD_INSECURE_SKIP_VERIFY %t, expected the self-signed sink to be reachable: %t", insecure, insecure)
+		}
+	}
+}
+
+func TestRun_SinkProbeRoutes(t *testing.T) {
+	captureLog(t)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	cfg := testConfig(t)
+	cfg.SinkProbeEnabled = true
+	cfg.Route = "type=.*:" + down.URL
+	startRun(t, cfg)
+
+	// The route sink is the only sink, and can't be reached.
+	time.Sleep(50 * time.Millisecond)
+	resp, err := http.Get(ceClientURL + readyzPath)
+	if err != nil {
+		t.Fatal("Error probing readiness:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Error("Expected the receiver not to be ready while the route sink is down, got", resp.StatusCode)
+	}
+}
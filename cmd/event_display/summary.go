@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+)
+
+// eventSummary accumulates aggregate statistics about received events. It is
+// safe for concurrent use.
+type eventSummary struct {
+	mu       sync.Mutex
+	total    uint64
+	byType   map[string]uint64
+	bySource map[string]uint64
+	// Number of events by partition key, for the events which have one,
+	// labeled like in the metrics to bound the number of keys.
+	byPartitionKey map[string]uint64
+	partitionKeys  *partitionKeyLabels
+
+	// Number of events and time at the last report, used to compute the rate
+	// of events between reports.
+	lastTotal uint64
+	lastTime  time.Time
+}
+
+// summaryReport is a snapshot of an eventSummary.
+type summaryReport struct {
+	Total           uint64
+	EventsPerSecond float64
+	ByType          map[string]uint64
+	BySource        map[string]uint64
+	// Nil when no event has a partition key.
+	ByPartitionKey map[string]uint64
+}
+
+func newEventSummary(now time.Time) *eventSummary {
+	return &eventSummary{
+		byType:         make(map[string]uint64),
+		bySource:       make(map[string]uint64),
+		byPartitionKey: make(map[string]uint64),
+		partitionKeys:  newPartitionKeyLabels(maxPartitionKeyLabels),
+		lastTime:       now,
+	}
+}
+
+// Add accounts for the given event in the summary.
+func (s *eventSummary) Add(event cloudevents.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total++
+	s.byType[event.Type()]++
+	s.bySource[event.Source()]++
+	if key, ok := partitionKey(event); ok {
+		s.byPartitionKey[s.partitionKeys.Label(key)]++
+	}
+}
+
+// Report returns a snapshot of the summary. The rate of events is computed
+// since the previous report.
+func (s *eventSummary) Report(now time.Time) summaryReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := summaryReport{
+		Total:    s.total,
+		ByType:   make(map[string]uint64, len(s.byType)),
+		BySource: make(map[string]uint64, len(s.bySource)),
+	}
+	for k, v := range s.byType {
+		r.ByType[k] = v
+	}
+	for k, v := range s.bySource {
+		r.BySource[k] = v
+	}
+	if len(s.byPartitionKey) > 0 {
+		r.ByPartitionKey = make(map[string]uint64, len(s.byPartitionKey))
+		for k, v := range s.byPartitionKey {
+			r.ByPartitionKey[k] = v
+		}
+	}
+	if elapsed := now.Sub(s.lastTime).Seconds(); elapsed > 0 {
+		r.EventsPerSecond = float64(s.total-s.lastTotal) / elapsed
+	}
+
+	s.lastTotal, s.lastTime = s.total, now
+	return r
+}
+
+// Run logs a report of the summary at every interval until ctx is cancelled.
+func (s *eventSummary) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			logSummary(s.Report(now))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close logs a final report of the summary, so events received since the last
+// report aren't left out.
+func (s *eventSummary) Close() error {
+	logSummary(s.Report(time.Now()))
+	return nil
+}
+
+func logSummary(r summaryReport) {
+	fields := []zap.Field{
+		zap.Uint64("total", r.Total),
+		zap.Float64("eventsPerSecond", r.EventsPerSecond),
+		zap.Any("byType", r.ByType),
+		zap.Any("bySource", r.BySource),
+	}
+	if r.ByPartitionKey != nil {
+		fields = append(fields, zap.Any("byPartitionKey", r.ByPartitionKey))
+	}
+	zap.L().Info("Events summary", fields...)
+}
+
+// summarize returns an eventHandler which accounts for each event in the given
+// summary instead of displaying it.
+func summarize(s *eventSummary) eventHandler {
+	return func(_ context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		eventsReceived.WithLabelValues(event.Type(), event.Source()).Inc()
+		countPartitionKey(event)
+		s.Add(event)
+		return nil, nil
+	}
+}
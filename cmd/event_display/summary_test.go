@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEventSummary_Report(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newEventSummary(start)
+	handler := summarize(s)
+
+	heartbeat := newTestEvent(t)
+	ping := newTestEvent(t)
+	ping.SetType("dev.knative.sources.ping")
+	ping.SetSource("/apis/v1/namespaces/default/pingsources/ping")
+
+	handler(context.Background(), heartbeat)
+	handler(context.Background(), heartbeat)
+	handler(context.Background(), ping)
+
+	want := summaryReport{
+		Total:           3,
+		EventsPerSecond: 0.3,
+		ByType: map[string]uint64{
+			heartbeat.Type(): 2,
+			ping.Type():      1,
+		},
+		BySource: map[string]uint64{
+			heartbeat.Source(): 2,
+			ping.Source():      1,
+		},
+	}
+	if diff := cmp.Diff(want, s.Report(start.Add(10*time.Second))); diff != "" {
+		t.Error("Unexpected report (-want, +got):", diff)
+	}
+
+	// The rate is computed since the previous report.
+	handler(context.Background(), ping)
+	if got := s.Report(start.Add(12 * time.Second)); got.Total != 4 || got.EventsPerSecond != 0.5 {
+		t.Errorf("Expected 4 events at 0.5 events/s, got %d events at %v events/s", got.Total, got.EventsPerSecond)
+	}
+}
+
+func TestEventSummary_PartitionKeys(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newEventSummary(start)
+	handler := summarize(s)
+	before := map[string]float64{
+		"orders-0": counterValue(t, "partitionkeys_total", map[string]string{"key": "orders-0"}),
+		"orders-1": counterValue(t, "partitionkeys_total", map[string]string{"key": "orders-1"}),
+	}
+
+	for _, key := range []string{"orders-0", "orders-1", "orders-0"} {
+		event := newTestEvent(t)
+		event.SetExtension("partitionkey", key)
+		handler(context.Background(), event)
+	}
+	// Events without a partition key are only counted in the total.
+	handler(context.Background(), newTestEvent(t))
+
+	want := map[string]uint64{"orders-0": 2, "orders-1": 1}
+	if diff := cmp.Diff(want, s.Report(start.Add(time.Second)).ByPartitionKey); diff != "" {
+		t.Error("Unexpected events by partition key (-want, +got):", diff)
+	}
+	for key, n := range want {
+		if got := counterValue(t, "partitionkeys_total", map[string]string{"key": key}) - before[key]; got != float64(n) {
+			t.Errorf("Expected %d events to be counted for partition key %q, got %v", n, key, got)
+		}
+	}
+}
+
+func TestEventSummary_PartitionKeysCapped(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newEventSummary(start)
+	for i := 0; i < maxPartitionKeyLabels+10; i++ {
+		event := newTestEvent(t)
+		event.SetExtension("partitionkey", "key-"+strconv.Itoa(i))
+		s.Add(event)
+	}
+
+	got := s.Report(start.Add(time.Second)).ByPartitionKey
+	if len(got) != maxPartitionKeyLabels+1 {
+		t.Errorf("Expected %d partition keys and %s, got %d keys", maxPartitionKeyLabels, otherPartitionKeys, len(got))
+	}
+	if got[otherPartitionKeys] != 10 {
+		t.Errorf("Expected the keys beyond the cap to be counted as %s, got %d", otherPartitionKeys, got[otherPartitionKeys])
+	}
+}
+
+func TestEventSummary_Run(t *testing.T) {
+	out := captureLog(t)
+	s := newEventSummary(time.Now())
+	summarize(s)(context.Background(), newTestEvent(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx, 10*time.Millisecond)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Summary reporting did not stop after its context was cancelled")
+	}
+
+	if !strings.Contains(out.String(), "Events summary") || !strings.Contains(out.String(), `"total": 1`) {
+		t.Errorf("Expected a summary to be logged, got:\n%s", out)
+	}
+}
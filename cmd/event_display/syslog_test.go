@@ -0,0 +1,83 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phayes/freeport"
+)
+
+func TestWithSyslog(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	defer server.Close()
+
+	var logBuf, eventBuf bytes.Buffer
+	logOut, eventOut, closeSyslog := withSyslog(&logBuf, &eventBuf, "udp://"+server.LocalAddr().String(), false)
+	defer closeSyslog()
+	if eventOut != &eventBuf {
+		t.Error("Expected events not to be sent to syslog")
+	}
+	if _, err := io.WriteString(logOut, "INFO\tStarting event_display\n"); err != nil {
+		t.Fatal("Error writing log:", err)
+	}
+
+	server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	b := make([]byte, 1024)
+	n, _, err := server.ReadFrom(b)
+	if err != nil {
+		t.Fatal("Error reading syslog message:", err)
+	}
+	if msg := string(b[:n]); !strings.Contains(msg, "event_display") || !strings.Contains(msg, "Starting event_display") {
+		t.Error("Unexpected syslog message:", msg)
+	}
+	if !strings.Contains(logBuf.String(), "Starting event_display") {
+		t.Errorf("Expected the log to be written to the log output too, got:\n%s", logBuf.String())
+	}
+}
+
+func TestWithSyslog_ConnectionFailure(t *testing.T) {
+	port, err := freeport.GetFreePort()
+	if err != nil {
+		t.Fatal("Error getting a free port:", err)
+	}
+
+	var logBuf, eventBuf bytes.Buffer
+	logOut, _, closeSyslog := withSyslog(&logBuf, &eventBuf, "tcp://127.0.0.1:"+strconv.Itoa(port), true)
+	defer closeSyslog()
+	if !strings.Contains(logBuf.String(), "Failed to connect to syslog") {
+		t.Errorf("Expected the connection failure to be reported, got:\n%s", logBuf.String())
+	}
+	if _, err := io.WriteString(logOut, "hello\n"); err != nil {
+		t.Fatal("Error writing log:", err)
+	}
+	if !strings.Contains(logBuf.String(), "hello") {
+		t.Errorf("Expected the log to be written to the log output, got:\n%s", logBuf.String())
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// HTTP path of the WebSocket endpoint streaming received events on the
+// metrics server.
+const tailPath = "/tail"
+
+// Number of messages buffered for each tailing client. Messages are dropped
+// for clients which fall further behind.
+const tailClientBuffer = 64
+
+// tailHub broadcasts messages to the connected tailing clients. It is safe for
+// concurrent use.
+type tailHub struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	closed  bool
+}
+
+func newTailHub() *tailHub {
+	return &tailHub{
+		clients: make(map[chan []byte]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the broadcast messages, closed once
+// unsubscribed or once the hub is closed.
+func (h *tailHub) Subscribe() chan []byte {
+	ch := make(chan []byte, tailClientBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+	} else {
+		h.clients[ch] = struct{}{}
+	}
+	return ch
+}
+
+// Unsubscribe stops sending messages to the given channel, and closes it.
+func (h *tailHub) Unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[ch]; ok {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// Broadcast sends the given message to all subscribers, without blocking.
+func (h *tailHub) Broadcast(msg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.clients {
+		select {
+		case ch <- msg:
+		default:
+			zap.L().Debug("Dropped message to slow tailing client")
+		}
+	}
+}
+
+// Close unsubscribes all subscribers.
+func (h *tailHub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.clients {
+		delete(h.clients, ch)
+		close(ch)
+	}
+	h.closed = true
+	return nil
+}
+
+// tailEvents returns an eventHandler which broadcasts each event as JSON to
+// the clients of the given hub before passing it to next.
+func tailEvents(hub *tailHub, next eventHandler) eventHandler {
+	return func(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		if b, err := json.Marshal(event); err != nil {
+			zap.L().Error("Failed to marshal event", zap.String("id", event.ID()), zap.Error(err))
+		} else {
+			hub.Broadcast(b)
+		}
+		return next(ctx, event)
+	}
+}
+
+// tailMiddleware exposes a WebSocket endpoint streaming the messages
+// broadcast by the given hub.
+func tailMiddleware(hub *tailHub, next http.Handler) http.Handler {
+	upgrader := websocket.Upgrader{}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != tailPath {
+			next.ServeHTTP(w, req)
+			return
+		}
+		// Subscribing first streams all events broadcast once the client is
+		// connected.
+		msgs := hub.Subscribe()
+		defer hub.Unsubscribe(msgs)
+
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			// The upgrader already responded with an error.
+			zap.L().Debug("Failed to upgrade tailing request", zap.Error(err))
+			return
+		}
+		defer conn.Close()
+
+		// Messages from the client are discarded, reading only detects that it
+		// disconnected.
+		disconnected := make(chan struct{})
+		go func() {
+			defer close(disconnected)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case msg, ok := <-msgs:
+				if !ok {
+					_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+					return
+				}
+				if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+					return
+				}
+			case <-disconnected:
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/websocket"
+)
+
+func TestRun_TailEndpoint(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.TailEnabled = true
+	startRun(t, cfg)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:9090"+tailPath, nil)
+	if err != nil {
+		t.Fatal("Error connecting to the tail endpoint:", err)
+	}
+	defer conn.Close()
+
+	event := newTestEvent(t)
+	if res := sendEvent(t, event); !cloudevents.IsACK(res) {
+		t.Fatal("Failed to send event:", res)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal("Error reading from the tail endpoint:", err)
+	}
+	got := cloudevents.NewEvent()
+	if err := json.Unmarshal(msg, &got); err != nil {
+		t.Fatalf("Expected a JSON CloudEvent: %v\n%s", err, msg)
+	}
+	if diff := cmp.Diff(event.String(), got.String()); diff != "" {
+		t.Error("Unexpected tailed event (-want, +got):", diff)
+	}
+}
+
+func TestTailHub_SlowClient(t *testing.T) {
+	hub := newTailHub()
+	slow := hub.Subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < tailClientBuffer+10; i++ {
+			hub.Broadcast([]byte("event"))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected broadcasting to a slow client not to block")
+	}
+	if got := len(slow); got != tailClientBuffer {
+		t.Errorf("Expected %d buffered messages, got %d", tailClientBuffer, got)
+	}
+
+	hub.Unsubscribe(slow)
+	hub.Broadcast([]byte("event"))
+	if err := hub.Close(); err != nil {
+		t.Fatal("Error closing hub:", err)
+	}
+	if _, ok := <-hub.Subscribe(); ok {
+		t.Error("Expected subscriptions to a closed hub to be closed")
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRun_TLS(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	cfg := testConfig(t)
+	cfg.TLSCertFile = certFile
+	cfg.TLSKeyFile = keyFile
+	startRun(t, cfg)
+
+	// plaintext request
+	resp, err := http.Get(ceClientURL + healthzPath)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Error("Expected plaintext request to be rejected, got status code:", resp.StatusCode)
+		}
+	}
+
+	// TLS request
+	httpsClient := newTestTLSClient(t, certFile, nil)
+	resp, err = httpsClient.Get("https://localhost:8080" + healthzPath)
+	if err != nil {
+		t.Fatal("Error sending TLS request to health endpoint:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Error("Unexpected status code sending TLS request to health endpoint:", resp.StatusCode)
+	}
+}
+
+func TestRun_TLSClientAuth(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	cfg := testConfig(t)
+	cfg.TLSCertFile = certFile
+	cfg.TLSKeyFile = keyFile
+	cfg.TLSClientCAFile = certFile
+	startRun(t, cfg)
+
+	if resp, err := newTestTLSClient(t, certFile, nil).Get("https://localhost:8080" + healthzPath); err == nil {
+		resp.Body.Close()
+		t.Error("Expected request without a client certificate to be rejected")
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := newTestTLSClient(t, certFile, &clientCert).Get("https://localhost:8080" + healthzPath)
+	if err != nil {
+		t.Fatal("Error sending request with a client certificate:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Error("Unexpected status code sending request with a client certificate:", resp.StatusCode)
+	}
+}
+
+func TestNewTLSConfig_Errors(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	if _, err := newTLSConfig(certFile, "", ""); err == nil {
+		t.Error("Expected an error for a missing key file")
+	}
+	if _, err := newTLSConfig(certFile, keyFile, keyFile); err == nil {
+		t.Error("Expected an error for a client CA file without certificates")
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for localhost and its
+// key to temporary files, and returns their paths.
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// newTestTLSClient returns an HTTP client trusting the certificate in
+// caFile, and presenting the given client certificate when it isn't nil.
+func newTestTLSClient(t *testing.T, caFile string, clientCert *tls.Certificate) *http.Client {
+	t.Helper()
+
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPEM)
+
+	cfg := &tls.Config{RootCAs: pool}
+	if clientCert != nil {
+		cfg.Certificates = []tls.Certificate{*clientCert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/tracing"
+	"knative.dev/pkg/tracing/config"
+)
+
+// setupTracing sets up the publishing of traces with the given JSON config.
+// A config which is malformed or fails to be applied falls back to the no-op
+// tracer, so that it doesn't prevent events from being displayed. Only failing
+// to set up the no-op tracer is an error.
+func setupTracing(logger *zap.Logger, jsonConfig string) (tracing.Tracer, error) {
+	conf := parseTracingConfig(logger, jsonConfig)
+
+	tracer, err := tracing.SetupPublishingWithStaticConfig(logger.Sugar(), "", conf)
+	if err == nil {
+		return tracer, nil
+	}
+	logger.Warn("Failed to apply tracing config, using the no-op default", zap.Error(err))
+	_ = tracer.Shutdown(context.Background())
+	return tracing.SetupPublishingWithStaticConfig(logger.Sugar(), "", config.NoopConfig())
+}
+
+// parseTracingConfig parses the given JSON tracing config, falling back to the
+// no-op config when it is empty or malformed.
+func parseTracingConfig(logger *zap.Logger, jsonConfig string) *config.Config {
+	if jsonConfig == "" {
+		return config.NoopConfig()
+	}
+	conf, err := config.JSONToTracingConfig(jsonConfig)
+	if err != nil {
+		logger.Warn("Failed to read tracing config, using the no-op default", zap.Error(err))
+		return config.NoopConfig()
+	}
+	return conf
+}
+
+// loadTracingConfig returns the JSON tracing config read from the file at
+// path, or the given config when path is empty or the file can't be read.
+func loadTracingConfig(logger *zap.Logger, path, jsonConfig string) string {
+	if path == "" {
+		return jsonConfig
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		logger.Warn("Failed to read tracing config file, using K_CONFIG_TRACING", zap.String("path", path), zap.Error(err))
+		return jsonConfig
+	}
+	return string(b)
+}
+
+// Interval at which the tracing config file is checked for changes.
+const tracingConfigPollInterval = 5 * time.Second
+
+// configurableTracer is a tracing.Tracer whose config can be changed at
+// runtime, like the OpenCensus tracer.
+type configurableTracer interface {
+	tracing.Tracer
+	ApplyConfig(*config.Config) error
+}
+
+// watchTracingConfig reads the tracing config file at path at every interval
+// until ctx is cancelled, and applies it to the tracer when it differs from
+// the last one applied, initially the given JSON config. Like at startup,
+// malformed configs fall back to the no-op config. Files which can't be read
+// are skipped, e.g. while a ConfigMap volume is being updated.
+func watchTracingConfig(ctx context.Context, logger *zap.Logger, tracer configurableTracer, path, jsonConfig string, interval time.Duration) {
+	last := []byte(jsonConfig)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil || bytes.Equal(b, last) {
+			continue
+		}
+		last = b
+		if err := tracer.ApplyConfig(parseTracingConfig(logger, string(b))); err != nil {
+			logger.Warn("Failed to apply reloaded tracing config", zap.Error(err))
+			continue
+		}
+		logger.Info("Reloaded tracing config", zap.String("path", path))
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+	"knative.dev/pkg/tracing/config"
+)
+
+func TestRun_MalformedTracingConfig(t *testing.T) {
+	out := captureLog(t)
+	cfg := testConfig(t)
+	cfg.ConfigTracing = `{"backend": "zipkin",`
+	startRun(t, cfg)
+
+	if res := sendEvent(t, newTestEvent(t)); !cloudevents.IsACK(res) {
+		t.Error("Expected the event to be received despite the tracing config, got:", res)
+	}
+	if !strings.Contains(out.String(), "Failed to read tracing config") {
+		t.Errorf("Expected the malformed tracing config to be reported, got:\n%s", out)
+	}
+}
+
+func TestSetupTracing(t *testing.T) {
+	out := captureLog(t)
+
+	for _, conf := range []string{"", `{"backend": "none"}`, "not json"} {
+		tracer, err := setupTracing(zap.L(), conf)
+		if err != nil {
+			t.Errorf("Unexpected error for tracing config %q: %v", conf, err)
+			continue
+		}
+		tracer.Shutdown(context.Background())
+	}
+
+	// An unset config is the no-op default and isn't reported.
+	if got := strings.Count(out.String(), "Failed to read tracing config"); got != 1 {
+		t.Errorf("Expected only the malformed config to be reported, got:\n%s", out)
+	}
+}
+
+func TestLoadTracingConfig(t *testing.T) {
+	captureLog(t)
+	path := filepath.Join(t.TempDir(), "config-tracing.json")
+	const fromFile = `{"backend": "none", "debug": "true"}`
+	if err := os.WriteFile(path, []byte(fromFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const fromEnv = `{"backend": "none"}`
+
+	if got := loadTracingConfig(zap.L(), path, fromEnv); got != fromFile {
+		t.Errorf("Expected the config to be read from the file, got %q", got)
+	}
+	if got := loadTracingConfig(zap.L(), filepath.Join(t.TempDir(), "missing.json"), fromEnv); got != fromEnv {
+		t.Errorf("Expected a missing file to fall back to the environment, got %q", got)
+	}
+	if got := loadTracingConfig(zap.L(), "", fromEnv); got != fromEnv {
+		t.Errorf("Expected the config to be read from the environment without path, got %q", got)
+	}
+}
+
+func TestWatchTracingConfig(t *testing.T) {
+	captureLog(t)
+	path := filepath.Join(t.TempDir(), "config-tracing.json")
+	const initial = `{"backend": "none"}`
+	if err := os.WriteFile(path, []byte(initial), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tracer := &testTracer{applied: make(chan *config.Config, 1)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchTracingConfig(ctx, zap.L(), tracer, path, initial, time.Millisecond)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	if err := os.WriteFile(path, []byte(`{"backend": "none", "debug": "true"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case conf := <-tracer.applied:
+		if !conf.Debug {
+			t.Error("Expected the changed config to be applied, got:", conf)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the changed config to be applied")
+	}
+}
+
+// testTracer is a configurableTracer sending applied configs to a channel.
+type testTracer struct {
+	applied chan *config.Config
+}
+
+func (t *testTracer) ApplyConfig(conf *config.Config) error {
+	t.applied <- conf
+	return nil
+}
+
+func (*testTracer) Shutdown(context.Context) error {
+	return nil
+}
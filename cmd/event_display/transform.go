@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.uber.org/zap"
+)
+
+// Context attributes which every event must have.
+var requiredAttributes = map[string]bool{
+	"id":          true,
+	"source":      true,
+	"specversion": true,
+	"type":        true,
+}
+
+// Context attributes which can be set by a transform.
+var settableAttributes = map[string]func(*cloudevents.Event, string){
+	"id":              (*cloudevents.Event).SetID,
+	"type":            (*cloudevents.Event).SetType,
+	"source":          (*cloudevents.Event).SetSource,
+	"subject":         (*cloudevents.Event).SetSubject,
+	"dataschema":      (*cloudevents.Event).SetDataSchema,
+	"datacontenttype": (*cloudevents.Event).SetDataContentType,
+}
+
+// eventTransform describes the changes applied to events. Renames are
+// applied before values are set.
+type eventTransform struct {
+	// Values of context attributes or extensions, by name.
+	Set map[string]string `json:"set"`
+	// New names of extensions, by current name.
+	Rename map[string]string `json:"rename"`
+}
+
+// parseTransform parses the JSON description of an eventTransform. It returns
+// an error if the transform can't be applied to valid events.
+func parseTransform(s string) (*eventTransform, error) {
+	var t eventTransform
+	if err := json.Unmarshal([]byte(s), &t); err != nil {
+		return nil, err
+	}
+
+	for from, to := range t.Rename {
+		switch {
+		case requiredAttributes[from]:
+			return nil, fmt.Errorf("cannot rename required attribute %q", from)
+		case isContextAttribute(from) || isContextAttribute(to):
+			return nil, fmt.Errorf("cannot rename %q to %q, only extensions can be renamed", from, to)
+		case !event.IsExtensionNameValid(from) || !event.IsExtensionNameValid(to):
+			return nil, fmt.Errorf("cannot rename %q to %q, invalid extension name", from, to)
+		}
+	}
+	for name, value := range t.Set {
+		if _, ok := settableAttributes[name]; !ok && (isContextAttribute(name) || !event.IsExtensionNameValid(name)) {
+			return nil, fmt.Errorf("cannot set %q", name)
+		}
+		if requiredAttributes[name] && value == "" {
+			return nil, fmt.Errorf("cannot set required attribute %q to an empty value", name)
+		}
+	}
+	return &t, nil
+}
+
+// isContextAttribute returns whether name is a context attribute defined by
+// the CloudEvents spec.
+func isContextAttribute(name string) bool {
+	switch name {
+	case "id", "source", "specversion", "type", "datacontenttype", "dataschema", "subject", "time", "data", "data_base64":
+		return true
+	}
+	return false
+}
+
+// Apply returns a copy of the given event with the transform applied.
+func (t *eventTransform) Apply(e cloudevents.Event) cloudevents.Event {
+	out := e.Clone()
+
+	// Renames are applied in a stable order in case they overlap.
+	froms := make([]string, 0, len(t.Rename))
+	for from := range t.Rename {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	extensions := e.Extensions()
+	for _, from := range froms {
+		if value, ok := extensions[from]; ok {
+			out.SetExtension(from, nil)
+			out.SetExtension(t.Rename[from], value)
+		}
+	}
+
+	for name, value := range t.Set {
+		if set, ok := settableAttributes[name]; ok {
+			set(&out, value)
+		} else {
+			out.SetExtension(name, value)
+		}
+	}
+	return out
+}
+
+// transformEvents returns an eventHandler which passes each event to next once
+// transformed. Events made invalid by the transform are rejected with a 400,
+// rather than displayed or forwarded.
+func transformEvents(t *eventTransform, next eventHandler) eventHandler {
+	return func(ctx context.Context, e cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		transformed := t.Apply(e)
+		if err := transformed.Validate(); err != nil {
+			zap.L().Warn("Transformed event is invalid", zap.String("id", e.ID()), zap.Error(err))
+			return nil, cehttp.NewResult(http.StatusBadRequest, "transformed event is invalid: %v", err)
+		}
+		return next(ctx, transformed)
+	}
+}
+
+// Name of the extension set by stampReceivedTime.
+const receivedTimeExtension = "receivedat"
+
+// stampReceivedTime returns an eventHandler which passes each event to next
+// with its time of reception, in UTC, as the receivedat extension.
+func stampReceivedTime(next eventHandler) eventHandler {
+	return func(ctx context.Context, e cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		stamped := e.Clone()
+		stamped.SetExtension(receivedTimeExtension, time.Now().UTC())
+		return next(ctx, stamped)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTransformEvents(t *testing.T) {
+	testCases := map[string]struct {
+		transform      string
+		wantType       string
+		wantExtensions map[string]interface{}
+	}{
+		"set extension": {
+			transform:      `{"set": {"environment": "prod"}}`,
+			wantType:       "dev.knative.eventing.samples.heartbeat",
+			wantExtensions: map[string]interface{}{"beats": true, "environment": "prod"},
+		},
+		"override type": {
+			transform:      `{"set": {"type": "com.example.heartbeat"}}`,
+			wantType:       "com.example.heartbeat",
+			wantExtensions: map[string]interface{}{"beats": true},
+		},
+		"rename extension": {
+			transform:      `{"rename": {"beats": "pulse"}}`,
+			wantType:       "dev.knative.eventing.samples.heartbeat",
+			wantExtensions: map[string]interface{}{"pulse": true},
+		},
+		"rename missing extension": {
+			transform:      `{"rename": {"heart": "pulse"}}`,
+			wantType:       "dev.knative.eventing.samples.heartbeat",
+			wantExtensions: map[string]interface{}{"beats": true},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			transform, err := parseTransform(tc.transform)
+			if err != nil {
+				t.Fatal("Error parsing transform:", err)
+			}
+			event := newTestEvent(t)
+
+			var got cloudevents.Event
+			handler := transformEvents(transform, func(_ context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+				got = event
+				return nil, nil
+			})
+			if _, res := handler(context.Background(), event); !cloudevents.IsACK(res) {
+				t.Error("Expected event to be acknowledged, got:", res)
+			}
+
+			if got.Type() != tc.wantType {
+				t.Errorf("Expected type %q, got %q", tc.wantType, got.Type())
+			}
+			if diff := cmp.Diff(tc.wantExtensions, got.Extensions()); diff != "" {
+				t.Error("Unexpected extensions (-want, +got):", diff)
+			}
+			if diff := cmp.Diff(map[string]interface{}{"beats": true}, event.Extensions()); diff != "" {
+				t.Error("Expected the received event to be left unchanged (-want, +got):", diff)
+			}
+		})
+	}
+}
+
+func TestTransformEvents_Invalid(t *testing.T) {
+	transform, err := parseTransform(`{"set": {"dataschema": "%zz"}}`)
+	if err != nil {
+		t.Fatal("Error parsing transform:", err)
+	}
+	captureLog(t)
+	handler := transformEvents(transform, func(context.Context, cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		t.Error("Expected the invalid event not to be passed on")
+		return nil, nil
+	})
+
+	_, res := handler(context.Background(), newTestEvent(t))
+	var httpResult *cehttp.Result
+	if !cloudevents.ResultAs(res, &httpResult) || httpResult.StatusCode != http.StatusBadRequest {
+		t.Error("Expected the invalid event to be rejected with a 400, got:", res)
+	}
+}
+
+func TestParseTransform_Invalid(t *testing.T) {
+	for _, transform := range []string{
+		`{"rename": {"type": "kind"}}`,
+		`{"rename": {"id": "eventid"}}`,
+		`{"rename": {"subject": "topic"}}`,
+		`{"rename": {"beats": "source"}}`,
+		`{"rename": {"beats": "pulse-rate"}}`,
+		`{"set": {"specversion": "0.3"}}`,
+		`{"set": {"time": "2019-10-18T15:23:20Z"}}`,
+		`{"set": {"env_name": "prod"}}`,
+		`{"set": {"id": ""}}`,
+		`{"set": {"source": ""}}`,
+		`{"set": {"type": ""}}`,
+		`{"set": `,
+	} {
+		if _, err := parseTransform(transform); err == nil {
+			t.Errorf("Expected an error for transform %s", transform)
+		}
+	}
+}
+
+func TestStampReceivedTime(t *testing.T) {
+	var got cloudevents.Event
+	handler := stampReceivedTime(func(_ context.Context, event cloudevents.Event) (*cloudevents.Event, cloudevents.Result) {
+		got = event
+		return nil, nil
+	})
+	before := time.Now()
+	handler(context.Background(), newTestEvent(t))
+
+	value, ok := got.Extensions()[receivedTimeExtension]
+	if !ok {
+		t.Fatal("Expected the event to have a received time extension, got:", got.Extensions())
+	}
+	if !event.IsExtensionNameValid(receivedTimeExtension) {
+		t.Errorf("Expected %q to be a valid extension name", receivedTimeExtension)
+	}
+	receivedAt, err := types.ToTime(value)
+	if err != nil {
+		t.Fatalf("Expected the received time %v to be a timestamp: %v", value, err)
+	}
+	if receivedAt.Before(before.Truncate(time.Second)) || receivedAt.After(time.Now()) {
+		t.Errorf("Expected the received time to be about now, got %v", receivedAt)
+	}
+	if err := got.Validate(); err != nil {
+		t.Error("Expected the stamped event to be valid, got:", err)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.uber.org/zap"
+)
+
+// validationMiddleware is a cehttp.Middleware which reports incoming events
+// that don't conform to the CloudEvents spec. Such events are rejected with a
+// 400 in strict mode, and acknowledged without being handled otherwise, as the
+// SDK rejects invalid events before they reach the handler.
+// Requests which don't carry an event are passed through.
+func validationMiddleware(strict bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				zap.L().Error("Failed to read request body", zap.Error(err))
+			}
+			_ = req.Body.Close()
+
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			event, err := binding.ToEvent(context.Background(), cehttp.NewMessageFromHttpRequest(req))
+			// Replace the body with a new reader after reading from the original
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			if err != nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			if err := event.Validate(); err != nil {
+				zap.L().Error("Invalid event", zap.String("type", event.Type()), zap.String("id", event.ID()), zap.Error(err))
+				eventsInvalid.WithLabelValues().Inc()
+				if strict {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				} else {
+					w.WriteHeader(http.StatusAccepted)
+				}
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
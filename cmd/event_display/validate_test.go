@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidationMiddleware(t *testing.T) {
+	testCases := map[string]struct {
+		strict      bool
+		withSource  bool
+		wantStatus  int
+		wantHandled bool
+		wantInvalid float64
+	}{
+		"valid event": {
+			withSource:  true,
+			wantStatus:  http.StatusOK,
+			wantHandled: true,
+		},
+		"missing source": {
+			wantStatus:  http.StatusAccepted,
+			wantInvalid: 1,
+		},
+		"missing source in strict mode": {
+			strict:      true,
+			wantStatus:  http.StatusBadRequest,
+			wantInvalid: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out := captureLog(t)
+			invalidBefore := counterValue(t, "events_invalid_total", nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":2}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Ce-Specversion", "1.0")
+			req.Header.Set("Ce-Id", "2b72d7bf-c38f-4a98-a433-608fbcdd2596")
+			req.Header.Set("Ce-Type", "dev.knative.eventing.samples.heartbeat")
+			if tc.withSource {
+				req.Header.Set("Ce-Source", "https://knative.dev/eventing/cmd/heartbeats")
+			}
+
+			var handled bool
+			next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				handled = true
+			})
+			rec := httptest.NewRecorder()
+			validationMiddleware(tc.strict)(next).ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if handled != tc.wantHandled {
+				t.Errorf("Expected event to be handled: %t, got: %t", tc.wantHandled, handled)
+			}
+			if got := counterValue(t, "events_invalid_total", nil) - invalidBefore; got != tc.wantInvalid {
+				t.Errorf("Expected %v invalid events to be counted, got %v", tc.wantInvalid, got)
+			}
+			if logged := strings.Contains(out.String(), "Invalid event"); logged != (tc.wantInvalid > 0) {
+				t.Errorf("Unexpected validation error log:\n%s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewMetricsHandler_Version(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newMetricsHandler(metricsOptions{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, versionPath, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatal("Unexpected status code:", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Error("Unexpected content type:", got)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Expected a JSON object: %v\n%s", err, rec.Body.String())
+	}
+	want := map[string]string{
+		"version":   version,
+		"commit":    commit,
+		"date":      date,
+		"goVersion": runtime.Version(),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("Unexpected build information (-want, +got):", diff)
+	}
+}